@@ -1,52 +1,105 @@
-package main
-
-import (
-	"friend-help/internal/cache"
-	"friend-help/internal/repo"
-	"friend-help/internal/service"
-	"friend-help/internal/transport/https"
-	"log"
-	"log/slog"
-	"os"
-
-	"github.com/joho/godotenv"
-)
-
-// @title           inmt API
-// @version         1.0
-// @description     API для инмт сайта
-// @host            localhost:8080
-// @BasePath        /api
-// @securityDefinitions.apikey BearerAuth
-// @in header
-// @name Authorization
-// @description Type "Bearer" followed by a space and JWT token.
-func main() {
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
-	if err := godotenv.Load("app.env"); err != nil {
-		log.Fatal("could not load .env file. Using OS environment variables: ", err)
-	}
-	db, err := repo.ConnectToBase()
-	if err != nil {
-		log.Fatal("DB connection failed: ", err)
-	}
-	if err := repo.RunMigrations(db); err != nil {
-		log.Fatal("could not run migration: ", err)
-	}
-	mysqlAuthRepo := repo.NewmysqlAuthRepo(db)
-	jwtService, err := service.NewJwtService()
-	if err != nil {
-		log.Fatal("JWT init failed: ", err)
-	}
-	cache, err := cache.NewRedisService()
-	if err != nil {
-		log.Fatal("Redis init failed: ", err)
-	}
-	authService := service.NewAuthService(mysqlAuthRepo, jwtService, cache)
-	HTTPHandlers := https.NewHTTPHandlers(authService)
-	port := os.Getenv("APP_PORT")
-	if port == "" {
-		log.Fatal("APP_PORT not set in environment or .env file.")
-	}
-	https.NewHTTPServer(HTTPHandlers, port)
-}
+package main
+
+import (
+	"context"
+	"friend-help/internal/cache"
+	"friend-help/internal/mail"
+	"friend-help/internal/policy"
+	"friend-help/internal/ratelimit"
+	"friend-help/internal/repo"
+	"friend-help/internal/service"
+	"friend-help/internal/transport/https"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// @title           inmt API
+// @version         1.0
+// @description     API для инмт сайта
+// @host            localhost:8080
+// @BasePath        /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and JWT token.
+func main() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := godotenv.Load("app.env"); err != nil {
+		log.Fatal("could not load .env file. Using OS environment variables: ", err)
+	}
+	db, err := repo.ConnectToBase()
+	if err != nil {
+		log.Fatal("DB connection failed: ", err)
+	}
+	if err := repo.RunMigrations(db); err != nil {
+		log.Fatal("could not run migration: ", err)
+	}
+	mysqlAuthRepo := repo.NewmysqlAuthRepo(db)
+	mysqlSessionRepo := repo.NewmysqlSessionRepo(db)
+	mysqlMFARepo := repo.NewmysqlMFARepo(db)
+	mysqlAuditRepo := repo.NewmysqlAuditRepo(db)
+	jwtService, err := service.NewJwtService()
+	if err != nil {
+		log.Fatal("JWT init failed: ", err)
+	}
+	if err := jwtService.WatchKeys(context.Background()); err != nil {
+		log.Fatal("JWT key watcher init failed: ", err)
+	}
+	cache, err := cache.NewRedisService()
+	if err != nil {
+		log.Fatal("Redis init failed: ", err)
+	}
+	mailer, err := mail.NewMailerFromEnv()
+	if err != nil {
+		log.Fatal("mail init failed: ", err)
+	}
+	// очередь писем останавливается после HTTP-сервера: запросы, которые
+	// он дообрабатывает при остановке, ещё могут ставить письма
+	mailCtx, stopMail := context.WithCancel(context.Background())
+	mailQueue, err := mail.NewQueueFromEnv(mailCtx, mailer)
+	if err != nil {
+		log.Fatal("mail queue init failed: ", err)
+	}
+	authService, err := service.NewAuthService(mysqlAuthRepo, mysqlSessionRepo, mysqlMFARepo, mysqlAuditRepo, jwtService, cache, mailQueue)
+	if err != nil {
+		log.Fatal("auth service init failed: ", err)
+	}
+	if migrated, err := authService.MigrateLegacyBlacklist(context.Background()); err != nil {
+		slog.Error("legacy blacklist migration failed, old entries are still honoured", "error", err)
+	} else if migrated > 0 {
+		slog.Info("legacy blacklist entries migrated", "count", migrated)
+	}
+	policyEngine, err := policy.NewEngineFromEnv()
+	if err != nil {
+		log.Fatal("policy init failed: ", err)
+	}
+	if err := policyEngine.Watch(context.Background()); err != nil {
+		log.Fatal("policy watcher init failed: ", err)
+	}
+	limiter, err := ratelimit.NewLimiterFromEnv(cache)
+	if err != nil {
+		log.Fatal("rate limiter init failed: ", err)
+	}
+	rateLimits, err := ratelimit.LoadRulesFromEnv()
+	if err != nil {
+		log.Fatal("rate limiter init failed: ", err)
+	}
+	HTTPHandlers := https.NewHTTPHandlers(authService, policyEngine, limiter, rateLimits)
+	port := os.Getenv("APP_PORT")
+	if port == "" {
+		log.Fatal("APP_PORT not set in environment or .env file.")
+	}
+	if err := https.NewHTTPServer(ctx, HTTPHandlers, port); err != nil {
+		slog.Error("HTTP server failed", "error", err)
+	}
+	stopMail()
+	mailQueue.Wait()
+	slog.Info("server stopped")
+}
@@ -1,50 +1,118 @@
-package cache
-
-import (
-	"context"
-	"fmt"
-	"friend-help/internal/errs"
-	"os"
-	"time"
-
-	"github.com/go-redis/redis/v8"
-)
-
-type RedisClient interface {
-	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
-	Get(ctx context.Context, key string) *redis.StringCmd
-	Close() error
-}
-
-type RedisService struct {
-	client *redis.Client
-}
-
-func NewRedisService() (*RedisService, error) {
-	addr := os.Getenv("REDIS_ADDR")
-	pass := os.Getenv("REDIS_PASS")
-	if addr == "" || pass == "" {
-		return nil, fmt.Errorf("REDIS_ADDR or REDIS_PASS not set")
-	}
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: pass,
-		DB:       1,
-	})
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToPingRedis, err)
-	}
-	return &RedisService{client: rdb}, nil
-}
-
-func (r *RedisService) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
-	return r.client.Set(ctx, key, value, expiration)
-}
-
-func (r *RedisService) Get(ctx context.Context, key string) *redis.StringCmd {
-	return r.client.Get(ctx, key)
-}
-
-func (r *RedisService) Close() error {
-	return r.client.Close()
-}
+package cache
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisClient interface {
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	GetDel(ctx context.Context, key string) *redis.StringCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	PTTL(ctx context.Context, key string) *redis.DurationCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
+	Close() error
+}
+
+type RedisService struct {
+	client *redis.Client
+}
+
+func NewRedisService() (*RedisService, error) {
+	addr := os.Getenv("REDIS_ADDR")
+	pass := os.Getenv("REDIS_PASS")
+	if addr == "" || pass == "" {
+		return nil, fmt.Errorf("REDIS_ADDR or REDIS_PASS not set")
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: pass,
+		DB:       1,
+	})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToPingRedis, err)
+	}
+	return &RedisService{client: rdb}, nil
+}
+
+func (r *RedisService) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	return r.client.Set(ctx, key, value, expiration)
+}
+
+func (r *RedisService) Get(ctx context.Context, key string) *redis.StringCmd {
+	return r.client.Get(ctx, key)
+}
+
+// GetDel атомарно читает и удаляет ключ (Redis >= 6.2).
+func (r *RedisService) GetDel(ctx context.Context, key string) *redis.StringCmd {
+	return r.client.GetDel(ctx, key)
+}
+
+func (r *RedisService) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return r.client.SetNX(ctx, key, value, expiration)
+}
+
+// SetXX обновляет значение и TTL, только если ключ уже существует.
+func (r *RedisService) SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return r.client.SetXX(ctx, key, value, expiration)
+}
+
+func (r *RedisService) Incr(ctx context.Context, key string) *redis.IntCmd {
+	return r.client.Incr(ctx, key)
+}
+
+func (r *RedisService) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return r.client.Expire(ctx, key, expiration)
+}
+
+func (r *RedisService) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	return r.client.Del(ctx, keys...)
+}
+
+func (r *RedisService) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	return r.client.Exists(ctx, keys...)
+}
+
+func (r *RedisService) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	return r.client.PTTL(ctx, key)
+}
+
+func (r *RedisService) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	return r.client.Scan(ctx, cursor, match, count)
+}
+
+// Eval, EvalSha, ScriptExists и ScriptLoad позволяют запускать через
+// RedisService Lua-скрипты (redis.Script).
+func (r *RedisService) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return r.client.Eval(ctx, script, keys, args...)
+}
+
+func (r *RedisService) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return r.client.EvalSha(ctx, sha1, keys, args...)
+}
+
+func (r *RedisService) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return r.client.ScriptExists(ctx, hashes...)
+}
+
+func (r *RedisService) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return r.client.ScriptLoad(ctx, script)
+}
+
+func (r *RedisService) Close() error {
+	return r.client.Close()
+}
@@ -1,26 +1,109 @@
-package errs
-
-import "errors"
-
-var (
-	ErrUserExists         = errors.New("user with this email/login already exists")
-	ErrUserNotFound       = errors.New("user with this email/login not found")
-	ErrInvalidLoginOrPass = errors.New("invalid login or password")
-
-	ErrFailedHashPass          = errors.New("failed to hash password")
-	ErrFailedGenToken          = errors.New("failed to generate token")
-	ErrFailedToComparePassHash = errors.New("failed to compare password hash")
-	ErrInvalidLoginChars       = errors.New("login contains disallowed characters")
-
-	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
-	ErrInvalidToken            = errors.New("token is invalid")
-	ErrInvalidTokenExpTime     = errors.New("token has no expiration time")
-
-	ErrFailedToAddUserInDB = errors.New("failed to create user in DB")
-	ErrDBInsertFailed      = errors.New("failed to insert in DB")
-
-	ErrFailedToOpenDB = errors.New("failed to open DB")
-	ErrFailedToPingDB = errors.New("failed to ping DB")
-
-	ErrFailedToPingRedis = errors.New("failed to connect to Redis")
-)
+package errs
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserExists         = errors.New("user with this email/login already exists")
+	ErrUserNotFound       = errors.New("user with this email/login not found")
+	ErrInvalidLoginOrPass = errors.New("invalid login or password")
+	ErrUserNotActivated   = errors.New("user email is not verified")
+	ErrEmailRequired      = errors.New("email is required")
+	ErrAccountLocked      = errors.New("account is temporarily locked after failed login attempts")
+	ErrTooManyAttempts    = errors.New("too many failed login attempts, try again later")
+
+	ErrFailedHashPass          = errors.New("failed to hash password")
+	ErrFailedGenToken          = errors.New("failed to generate token")
+	ErrFailedToComparePassHash = errors.New("failed to compare password hash")
+	ErrInvalidLoginChars       = errors.New("login contains disallowed characters")
+	ErrFailedToUpdatePassword  = errors.New("failed to update password")
+	ErrInvalidCurrentPassword  = errors.New("current password is incorrect")
+	ErrPasswordUnchanged       = errors.New("new password must differ from the current one")
+	ErrWeakPassword            = errors.New("password does not meet the password policy")
+	ErrPasswordExpired         = errors.New("password has expired, log in again to change it")
+
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrUnsupportedSigningAlg   = errors.New("unsupported JWT signing algorithm")
+	ErrInvalidSigningKey       = errors.New("invalid JWT signing key")
+	ErrUnknownKeyID            = errors.New("unknown JWT key id")
+	ErrRetiredKeyID            = errors.New("JWT key is retired")
+	ErrInvalidToken            = errors.New("token is invalid")
+	ErrInvalidTokenExpTime     = errors.New("token has no expiration time")
+	ErrInvalidActionToken      = errors.New("token is invalid, expired or already used")
+
+	ErrInvalidRefreshToken   = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused    = errors.New("refresh token reuse detected")
+	ErrFailedGenRefreshToken = errors.New("failed to generate refresh token")
+	ErrFailedToStoreRefresh  = errors.New("failed to store refresh token")
+
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrMFANotConfigured           = errors.New("MFA is not configured on the server")
+	ErrTOTPNotEnabled             = errors.New("TOTP is not enabled")
+	ErrTOTPAlreadyEnabled         = errors.New("TOTP is already enabled")
+	ErrInvalidTOTPCode            = errors.New("invalid or already used TOTP code")
+	ErrInvalidRecoveryCode        = errors.New("invalid or already used recovery code")
+	ErrWebAuthnNotConfigured      = errors.New("webauthn is not configured on the server")
+	ErrInvalidWebAuthnChallenge   = errors.New("webauthn challenge is invalid or expired")
+	ErrInvalidWebAuthnCredential  = errors.New("webauthn credential verification failed")
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+	ErrInvalidSecretCipher        = errors.New("failed to decrypt secret")
+
+	ErrUnknownRole = errors.New("unknown role")
+
+	ErrInvalidPolicy = errors.New("invalid policy")
+
+	ErrInvalidMailMessage = errors.New("invalid mail message")
+	ErrMailTemplate       = errors.New("failed to render mail template")
+	ErrMailQueueFull      = errors.New("mail queue is full")
+
+	ErrFailedToAddUserInDB = errors.New("failed to create user in DB")
+	ErrDBInsertFailed      = errors.New("failed to insert in DB")
+
+	ErrFailedToOpenDB = errors.New("failed to open DB")
+	ErrFailedToPingDB = errors.New("failed to ping DB")
+
+	ErrFailedToPingRedis = errors.New("failed to connect to Redis")
+)
+
+// RetryAfterError сообщает, когда можно повторить запрос; оборачивает
+// ErrAccountLocked или ErrTooManyAttempts.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// PasswordViolation — нарушенное правило парольной политики.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError перечисляет все нарушенные правила; оборачивает ErrWeakPassword.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return ErrWeakPassword.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
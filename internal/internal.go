@@ -1,3 +1,3 @@
-package internal
-
-// чтобы свагер не ругался при init
+package internal
+
+// чтобы свагер не ругался при init
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer складывает письма в каталог в виде .eml-файлов — для разработки и тестов.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail dir: %w", err)
+	}
+	if from == "" {
+		from = "noreply@localhost"
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// ConsoleMailer печатает текстовую часть письма в w (обычно stdout).
+type ConsoleMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewConsoleMailer(w io.Writer, from string) *ConsoleMailer {
+	return &ConsoleMailer{w: w, from: from}
+}
+
+func (m *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.w, "----- mail -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n----------------\n", m.from, msg.To, msg.Subject, msg.Text)
+	return err
+}
+
+func sanitize(s string) string {
+	out := []rune(s)
+	for i, r := range out {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == '@') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
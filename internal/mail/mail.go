@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"friend-help/internal/errs"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message — готовое к отправке письмо. HTML может быть пустым.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailerFromEnv выбирает транспорт по MAIL_BACKEND: smtp, file или console.
+// Значения по умолчанию нет: console печатает ссылки из писем в stdout, то есть
+// в логи, поэтому его нужно включить явно, а при GIN_MODE=release он запрещён.
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "smtp":
+		if from == "" {
+			return nil, fmt.Errorf("var MAIL_FROM not found")
+		}
+		return newSMTPMailerFromEnv(from)
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("var MAIL_DIR not found")
+		}
+		return NewFileMailer(dir, from)
+	case "console":
+		if os.Getenv("GIN_MODE") == "release" {
+			return nil, fmt.Errorf("var MAIL_BACKEND=console is not allowed with GIN_MODE=release: it prints mail links to stdout")
+		}
+		slog.Warn("mail backend is console: emails, including their links, are printed to stdout")
+		return NewConsoleMailer(os.Stdout, from), nil
+	case "":
+		return nil, fmt.Errorf("var MAIL_BACKEND not found")
+	default:
+		return nil, fmt.Errorf("var MAIL_BACKEND bad format: %q", backend)
+	}
+}
+
+// Bytes собирает письмо в формате RFC 5322: multipart/alternative из
+// текстовой и HTML-части в quoted-printable.
+func (m Message) Bytes(from string) ([]byte, error) {
+	if m.To == "" {
+		return nil, fmt.Errorf("%w: empty recipient", errs.ErrInvalidMailMessage)
+	}
+	if strings.ContainsAny(m.To+m.Subject+from, "\r\n") {
+		return nil, fmt.Errorf("%w: line break in header", errs.ErrInvalidMailMessage)
+	}
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		from = addr.String()
+	}
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+body.Boundary())
+	buf.WriteString("\r\n")
+	if err := writePart(body, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if m.HTML != "" {
+		if err := writePart(body, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writePart(w *multipart.Writer, contentType, content string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%x.%d@%s>", b, time.Now().UnixNano(), domain)
+}
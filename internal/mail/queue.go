@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize     = 1000
+	defaultQueueWorkers  = 2
+	defaultQueueAttempts = 5
+	queueBaseBackoff     = 2 * time.Second
+	queueMaxBackoff      = 5 * time.Minute
+	queueSendTimeout     = time.Minute
+)
+
+// Queue — Mailer, который только ставит письмо в очередь и сразу возвращает
+// управление. Доставка идёт в фоне с повторами и экспоненциальной паузой;
+// ответы SMTP 5xx не повторяются.
+type Queue struct {
+	next     Mailer
+	jobs     chan Message
+	attempts int
+	wg       sync.WaitGroup
+}
+
+// NewQueueFromEnv читает MAIL_QUEUE_SIZE, MAIL_QUEUE_WORKERS и MAIL_MAX_ATTEMPTS
+// и запускает обработчики, которые работают до отмены ctx.
+func NewQueueFromEnv(ctx context.Context, next Mailer) (*Queue, error) {
+	size, err := intFromEnv("MAIL_QUEUE_SIZE", defaultQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	workers, err := intFromEnv("MAIL_QUEUE_WORKERS", defaultQueueWorkers)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := intFromEnv("MAIL_MAX_ATTEMPTS", defaultQueueAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return NewQueue(ctx, next, size, workers, attempts), nil
+}
+
+func NewQueue(ctx context.Context, next Mailer, size, workers, attempts int) *Queue {
+	q := &Queue{next: next, jobs: make(chan Message, size), attempts: attempts}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	return q
+}
+
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return errs.ErrMailQueueFull
+	}
+}
+
+// Wait дожидается остановки обработчиков после отмены контекста. Письма,
+// которые остались в очереди, не отправляются — их число пишется в лог.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+	if pending := len(q.jobs); pending > 0 {
+		slog.Warn("mail queue stopped with undelivered messages", "count", pending)
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-q.jobs:
+			q.deliver(ctx, msg)
+		}
+	}
+}
+
+func (q *Queue) deliver(ctx context.Context, msg Message) {
+	backoff := queueBaseBackoff
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, queueSendTimeout)
+		err := q.next.Send(sendCtx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= q.attempts || permanent(err) {
+			slog.Error("mail delivery failed", "to", msg.To, "subject", msg.Subject, "attempts", attempt, "error", err)
+			return
+		}
+		slog.Warn("mail delivery failed, retrying", "to", msg.To, "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, queueMaxBackoff)
+	}
+}
+
+func intFromEnv(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("var %s bad format: %q", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPMailer отправляет письма через SMTP-сервер. Режим TLS:
+// starttls (по умолчанию, порт 587), tls (неявный TLS, порт 465) или none.
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	tlsMode  string
+	timeout  time.Duration
+}
+
+func newSMTPMailerFromEnv(from string) (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+		tlsMode:  os.Getenv("SMTP_TLS"),
+		timeout:  defaultSMTPTimeout,
+	}
+	if m.host == "" {
+		return nil, fmt.Errorf("var SMTP_HOST not found")
+	}
+	switch m.tlsMode {
+	case "":
+		m.tlsMode = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("var SMTP_TLS bad format: %q", m.tlsMode)
+	}
+	if m.port == "" {
+		m.port = "587"
+		if m.tlsMode == "tls" {
+			m.port = "465"
+		}
+	}
+	if _, err := strconv.Atoi(m.port); err != nil {
+		return nil, fmt.Errorf("var SMTP_PORT bad format: %q", m.port)
+	}
+	if _, err := netmail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("var MAIL_FROM bad format: %w", err)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+	sender, err := netmail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(m.timeout)
+	}
+	conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if m.tlsMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.host, m.port)
+	dialer := &net.Dialer{Timeout: m.timeout}
+	if m.tlsMode == "tls" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.host}}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// permanent сообщает, что повторять отправку бессмысленно (ответ SMTP 5xx).
+func permanent(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code >= 500
+}
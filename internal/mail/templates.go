@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"friend-help/internal/errs"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Шаблоны лежат в templates/<имя>/<язык>.txt и <язык>.html. Текстовый шаблон
+// определяет блоки "subject" и "text", HTML-шаблон необязателен.
+//
+//go:embed templates
+var templatesFS embed.FS
+
+const DefaultLanguage = "ru"
+
+var Languages = []string{"ru", "en"}
+
+// Render собирает письмо по шаблону name на языке lang (или на DefaultLanguage,
+// если такого варианта нет).
+func Render(name, lang string, to string, data interface{}) (Message, error) {
+	lang = MatchLanguage(lang)
+	base := "templates/" + name + "/"
+	textTmpl, err := texttemplate.ParseFS(templatesFS, base+lang+".txt")
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %s/%s: %w", errs.ErrMailTemplate, name, lang, err)
+	}
+	msg := Message{To: to}
+	var buf bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("%w: %w", errs.ErrMailTemplate, err)
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := textTmpl.ExecuteTemplate(&buf, "text", data); err != nil {
+		return Message{}, fmt.Errorf("%w: %w", errs.ErrMailTemplate, err)
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+	if _, err := templatesFS.Open(base + lang + ".html"); err == nil {
+		htmlTmpl, err := htmltemplate.ParseFS(templatesFS, base+lang+".html")
+		if err != nil {
+			return Message{}, fmt.Errorf("%w: %w", errs.ErrMailTemplate, err)
+		}
+		buf.Reset()
+		if err := htmlTmpl.Execute(&buf, data); err != nil {
+			return Message{}, fmt.Errorf("%w: %w", errs.ErrMailTemplate, err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+// MatchLanguage выбирает поддерживаемый язык по значению вроде "en-US" или
+// заголовку Accept-Language ("en-GB,en;q=0.9,ru;q=0.8").
+func MatchLanguage(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		for _, lang := range Languages {
+			if primary == lang {
+				return lang
+			}
+		}
+	}
+	return DefaultLanguage
+}
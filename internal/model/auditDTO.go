@@ -0,0 +1,19 @@
+package model
+
+// События журнала аудита.
+const (
+	AuditTOTPEnabled              = "mfa.totp_enabled"
+	AuditTOTPDisabled             = "mfa.totp_disabled"
+	AuditRecoveryCodeUsed         = "mfa.recovery_code_used"
+	AuditRecoveryCodesRegenerated = "mfa.recovery_codes_regenerated"
+	AuditWebAuthnRegistered       = "mfa.webauthn_registered"
+	AuditWebAuthnRemoved          = "mfa.webauthn_removed"
+	AuditWebAuthnCloneWarning     = "mfa.webauthn_clone_warning"
+)
+
+type AuditEvent struct {
+	UserID  int
+	Event   string
+	Client  ClientInfo
+	Details map[string]interface{}
+}
@@ -1,31 +1,130 @@
-package model
-
-import (
-	"github.com/golang-jwt/jwt/v5"
-)
-
-type AuthRegReq struct {
-	Login    string `json:"username" binding:"required,min=4,max=32"`
-	Email    string `json:"email,omitempty" binding:"omitempty,email,max=100"`
-	Password string `json:"password" binding:"required,min=8,max=32"`
-}
-
-type AuthLogReq struct {
-	Identifier string `json:"identifier" binding:"required,max=100"` // Логин ИЛИ Email
-	Password   string `json:"password" binding:"required,max=32"`
-}
-
-type AuthUser struct {
-	ID           int
-	Login        string
-	Username     string
-	Email        *string
-	PasswordHash string
-	IsActivated  bool
-}
-
-type AuthClaims struct {
-	UserID int `json:"user_id"`
-	Role   int `json:"role"`
-	jwt.RegisteredClaims
-}
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type AuthRegReq struct {
+	Login    string `json:"username" binding:"required,min=4,max=32"`
+	Email    string `json:"email,omitempty" binding:"omitempty,email,max=100"`
+	Password string `json:"password" binding:"required,max=256"`
+}
+
+type AuthLogReq struct {
+	Identifier string `json:"identifier" binding:"required,max=100"` // Логин ИЛИ Email
+	Password   string `json:"password" binding:"required,max=256"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationReq struct {
+	Identifier string `json:"identifier" binding:"required,max=100"` // Логин ИЛИ Email
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email,max=100"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,max=256"`
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=256"`
+	NewPassword     string `json:"new_password" binding:"required,max=256"`
+}
+
+type AuthUser struct {
+	ID                int
+	Login             string
+	Username          string
+	Email             *string
+	PasswordHash      string
+	PasswordChangedAt time.Time
+	IsActivated       bool
+	TokenVersion      int
+	Role              int
+}
+
+// Значения заголовка typ: access-токены и одноразовые токены действий
+// (подтверждение email и т.п.) не взаимозаменяемы.
+const (
+	AccessTokenType = "JWT"
+	ActionTokenType = "action+jwt"
+)
+
+type AuthClaims struct {
+	UserID       int    `json:"user_id"`
+	Role         int    `json:"role"`
+	TokenVersion int    `json:"ver"`
+	SessionID    string `json:"sid,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ActionClaims — claims одноразового токена действия. Purpose задаёт,
+// для какой операции токен выпущен.
+type ActionClaims struct {
+	UserID  int    `json:"user_id"`
+	Purpose string `json:"purpose"`
+	// TokenVersion — users.token_version на момент выпуска; по нему
+	// password_change_token отзывается "выйти везде" и сменой пароля.
+	TokenVersion int `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// Permissions разбирает claim scope (права через пробел, как в OAuth 2.0).
+func (c *AuthClaims) Permissions() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *AuthClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions() {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenSubject — данные пользователя, которые попадают в access-токен.
+type TokenSubject struct {
+	UserID       int
+	Role         int
+	TokenVersion int
+	SessionID    string
+	Permissions  []string
+	// Passkey — сессия открыта входом по passkey: срок пароля её не ограничивает.
+	Passkey bool
+}
+
+type SetRoleReq struct {
+	Role string `json:"role" binding:"required,oneof=member moderator admin"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=128"`
+}
+
+type LogoutReq struct {
+	RefreshToken string `json:"refresh_token,omitempty" binding:"omitempty,max=128"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshSession struct {
+	UserID       int    `json:"user_id"`
+	FamilyID     string `json:"family_id"`
+	TokenVersion int    `json:"ver"`
+	Passkey      bool   `json:"passkey,omitempty"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// AuthzCheckReq — запрос к /api/authz/check. Субъект берётся из токена,
+// request добавляет атрибуты запроса; атрибуты, которые вычисляет сервер
+// (ip, method, path, route, hour, weekday), переопределить нельзя —
+// кроме ip, если в токене есть право authz:check.
+type AuthzCheckReq struct {
+	Action   string                 `json:"action" binding:"required"`
+	Resource map[string]interface{} `json:"resource,omitempty"`
+	Request  map[string]interface{} `json:"request,omitempty"`
+}
+
+type AuthzCheckResp struct {
+	Allowed  bool   `json:"allowed"`
+	PolicyID string `json:"policy_id,omitempty"`
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+// TOTPSecret — строка user_totp. Секрет зашифрован (AES-GCM), ConfirmedAt
+// пуст, пока пользователь не подтвердил подключение первым кодом.
+type TOTPSecret struct {
+	UserID      int
+	SecretEnc   []byte
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+}
+
+// WebAuthnCredential — строка webauthn_credentials: открытый ключ passkey
+// и счётчик подписей, по которому обнаруживаются клоны аутентификатора.
+type WebAuthnCredential struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"-"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      []string   `json:"transports"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnBeginResp — параметры церемонии для navigator.credentials.create/get.
+// ChallengeID нужно вернуть в запросе завершения вместе с ответом аутентификатора.
+type WebAuthnBeginResp struct {
+	ChallengeID string      `json:"challenge_id"`
+	Options     interface{} `json:"options"`
+}
+
+type WebAuthnRegisterFinishReq struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Name        string          `json:"name" binding:"max=64"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnRegisterFinishResp struct {
+	Credential    WebAuthnCredential `json:"credential"`
+	RecoveryCodes []string           `json:"recovery_codes,omitempty"`
+}
+
+type WebAuthnLoginFinishReq struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnMFABeginReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type WebAuthnMFAFinishReq struct {
+	MFAToken    string          `json:"mfa_token" binding:"required"`
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnDeleteReq struct {
+	Password string `json:"password" binding:"required,max=256"`
+}
+
+type TOTPSetupResp struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TOTPCodeReq struct {
+	Code string `json:"code" binding:"required,numeric,len=6"`
+}
+
+type TOTPDisableReq struct {
+	Password string `json:"password" binding:"required,max=256"`
+	Code     string `json:"code" binding:"required,numeric,len=6"`
+}
+
+// MFAVerifyReq принимает либо код из приложения, либо одноразовый код восстановления.
+type MFAVerifyReq struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code,omitempty" binding:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code,omitempty" binding:"required_without=Code,omitempty,max=32"`
+}
+
+type RecoveryCodesReq struct {
+	Password string `json:"password" binding:"required,max=256"`
+}
+
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginResult — итог проверки пароля: либо пара токенов, либо MFAToken,
+// который нужно обменять на токены через /api/auth/mfa/verify, либо
+// (при истёкшем пароле) PasswordChangeToken для смены пароля.
+type LoginResult struct {
+	User                *AuthUser
+	Tokens              *TokenPair
+	MFAToken            string
+	MFAMethods          []string
+	PasswordExpired     bool
+	PasswordChangeToken string
+}
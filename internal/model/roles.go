@@ -1,5 +1,23 @@
-package model
-
-const (
-	Member = 1
-)
+package model
+
+const (
+	Member    = 1
+	Moderator = 2
+	Admin     = 3
+)
+
+// RoleNames совпадает с содержимым таблицы roles, которую заполняют миграции.
+var RoleNames = map[int]string{
+	Member:    "member",
+	Moderator: "moderator",
+	Admin:     "admin",
+}
+
+func RoleByName(name string) (int, bool) {
+	for id, roleName := range RoleNames {
+		if roleName == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
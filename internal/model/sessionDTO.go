@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// ClientInfo — откуда пришёл запрос на вход; сохраняется в сессии.
+// Language — предпочтительный язык писем из Accept-Language.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+	Language  string
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
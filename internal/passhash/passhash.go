@@ -0,0 +1,164 @@
+// Package passhash хеширует пароли. Новые хеши — argon2id в PHC-формате
+// ($argon2id$v=19$m=65536,t=3,p=4$<соль>$<хеш>), старые bcrypt-хеши
+// продолжают проверяться, а NeedsRehash подсказывает, что хеш сделан
+// другим алгоритмом или с другими параметрами и его пора обновить.
+package passhash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// BcryptMaxPasswordBytes — bcrypt учитывает только первые 72 байта пароля.
+const BcryptMaxPasswordBytes = 72
+
+var (
+	ErrUnknownHash     = errors.New("unknown password hash format")
+	ErrMalformedHash   = errors.New("malformed password hash")
+	ErrPasswordTooLong = errors.New("password is too long for the hash algorithm")
+)
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify возвращает false без ошибки, если пароль не подходит;
+	// ошибка — только для повреждённого или незнакомого хеша.
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash сообщает, что хеш сделан не текущим алгоритмом или
+	// не с текущими параметрами.
+	NeedsRehash(encoded string) bool
+}
+
+// Hasher создаёт хеши выбранным алгоритмом, а проверяет любым известным.
+type Hasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+func New(algorithm string, argon2 Argon2Params, bcryptCost int) (*Hasher, error) {
+	switch algorithm {
+	case Argon2id:
+		if err := argon2.validate(); err != nil {
+			return nil, err
+		}
+	case Bcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bad bcrypt cost %d: want %d..%d", bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+	return &Hasher{algorithm: algorithm, argon2: argon2, bcryptCost: bcryptCost}, nil
+}
+
+// NewFromEnv читает PASSWORD_HASH_ALGORITHM (argon2id по умолчанию или bcrypt),
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM и BCRYPT_COST;
+// пустая переменная — значение по умолчанию.
+func NewFromEnv() (*Hasher, error) {
+	algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if algorithm == "" {
+		algorithm = Argon2id
+	}
+	params := DefaultArgon2Params
+	memory, err := envUint("ARGON2_MEMORY_KIB", params.Memory, 32)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := envUint("ARGON2_ITERATIONS", params.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	parallelism, err := envUint("ARGON2_PARALLELISM", uint32(params.Parallelism), 8)
+	if err != nil {
+		return nil, err
+	}
+	params.Memory, params.Iterations, params.Parallelism = memory, iterations, uint8(parallelism)
+	cost, err := envUint("BCRYPT_COST", uint32(bcrypt.DefaultCost), 8)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := New(algorithm, params, int(cost))
+	if err != nil {
+		return nil, fmt.Errorf("bad password hashing config: %w", err)
+	}
+	return hasher, nil
+}
+
+func envUint(name string, def uint32, bits int) (uint32, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("var %s bad format: %q", name, v)
+	}
+	return uint32(n), nil
+}
+
+// MaxPasswordBytes — самый длинный пароль в байтах, который Hash примет;
+// 0 — без ограничения.
+func (h *Hasher) MaxPasswordBytes() int {
+	if h.algorithm == Bcrypt {
+		return BcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		if len(password) > BcryptMaxPasswordBytes {
+			return "", ErrPasswordTooLong
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+	return hashArgon2id(password, h.argon2)
+}
+
+func (h *Hasher) Verify(encoded, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+Argon2id+"$"):
+		return verifyArgon2id(encoded, password)
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+		}
+		return true, nil
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if h.algorithm == Bcrypt {
+		if !isBcrypt(encoded) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.bcryptCost
+	}
+	params, _, _, err := decodeArgon2id(encoded)
+	return err != nil || params != h.argon2
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
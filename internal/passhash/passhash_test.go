@@ -0,0 +1,147 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newHasher(t *testing.T, algorithm string, params Argon2Params, cost int) *Hasher {
+	t.Helper()
+	h, err := New(algorithm, params, cost)
+	if err != nil {
+		t.Fatalf("New(%s): %v", algorithm, err)
+	}
+	return h
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost)
+	for _, password := range []string{"Correct-horse-42", "пароль с пробелами", strings.Repeat("x", 200)} {
+		encoded, err := h.Hash(password)
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		if ok, err := h.Verify(encoded, password); err != nil || !ok {
+			t.Fatalf("Verify(own hash) = %v, %v; want true", ok, err)
+		}
+		if ok, err := h.Verify(encoded, password+"!"); err != nil || ok {
+			t.Fatalf("Verify(wrong password) = %v, %v; want false", ok, err)
+		}
+		if h.NeedsRehash(encoded) {
+			t.Fatalf("NeedsRehash(fresh hash) = true")
+		}
+	}
+}
+
+func TestArgon2idPHCFormat(t *testing.T) {
+	h := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost)
+	encoded, err := h.Hash("Correct-horse-42")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != "v=19" || parts[3] != "m=64,t=1,p=1" {
+		t.Fatalf("hash %q is not $argon2id$v=19$m=64,t=1,p=1$<salt>$<key>", encoded)
+	}
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil || len(salt) != 16 {
+		t.Fatalf("salt %q: %d bytes, %v; want 16 bytes of unpadded base64", parts[4], len(salt), err)
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil || len(key) != 32 {
+		t.Fatalf("key %q: %d bytes, %v; want 32 bytes of unpadded base64", parts[5], len(key), err)
+	}
+	again, _ := h.Hash("Correct-horse-42")
+	if again == encoded {
+		t.Fatal("two hashes of one password are equal: salt is not random")
+	}
+}
+
+func TestVerifyMalformedHashes(t *testing.T) {
+	h := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost)
+	cases := map[string]error{
+		"plaintext":                               ErrUnknownHash,
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA":      ErrMalformedHash,
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5": ErrMalformedHash,
+		"$2a$04$short":                            ErrMalformedHash,
+	}
+	for encoded, want := range cases {
+		if _, err := h.Verify(encoded, "x"); !errors.Is(err, want) {
+			t.Errorf("Verify(%q): err = %v, want %v", encoded, err, want)
+		}
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	h := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost)
+	raw, err := bcrypt.GenerateFromPassword([]byte("Correct-horse-42"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	// $2y$ пишет PHP, $2b$ — современные библиотеки: все варианты проверяются одинаково
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		encoded := prefix + string(raw[4:])
+		if ok, err := h.Verify(encoded, "Correct-horse-42"); err != nil || !ok {
+			t.Errorf("Verify(%s…) = %v, %v; want true", prefix, ok, err)
+		}
+		if ok, err := h.Verify(encoded, "wrong"); err != nil || ok {
+			t.Errorf("Verify(%s…, wrong) = %v, %v; want false", prefix, ok, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost)
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	argonStronger := newHasher(t, Argon2id, stronger, bcrypt.MinCost)
+	bcryptMin := newHasher(t, Bcrypt, testArgon2Params, bcrypt.MinCost)
+	bcryptMore := newHasher(t, Bcrypt, testArgon2Params, bcrypt.MinCost+1)
+
+	argonHash, _ := argon.Hash("Correct-horse-42")
+	bcryptHash, _ := bcryptMin.Hash("Correct-horse-42")
+
+	cases := []struct {
+		name    string
+		hasher  *Hasher
+		encoded string
+		want    bool
+	}{
+		{"argon2id, same params", argon, argonHash, false},
+		{"argon2id, new params", argonStronger, argonHash, true},
+		{"bcrypt under argon2id", argon, bcryptHash, true},
+		{"bcrypt, same cost", bcryptMin, bcryptHash, false},
+		{"bcrypt, new cost", bcryptMore, bcryptHash, true},
+		{"argon2id under bcrypt", bcryptMin, argonHash, true},
+		{"garbage", argon, "garbage", true},
+	}
+	for _, c := range cases {
+		if got := c.hasher.NeedsRehash(c.encoded); got != c.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	h := newHasher(t, Bcrypt, testArgon2Params, bcrypt.MinCost)
+	if got := h.MaxPasswordBytes(); got != BcryptMaxPasswordBytes {
+		t.Fatalf("MaxPasswordBytes = %d, want %d", got, BcryptMaxPasswordBytes)
+	}
+	if _, err := h.Hash(strings.Repeat("x", BcryptMaxPasswordBytes)); err != nil {
+		t.Fatalf("Hash(72 bytes): %v", err)
+	}
+	// 37 кириллических символов — 74 байта
+	for _, password := range []string{strings.Repeat("x", BcryptMaxPasswordBytes+1), strings.Repeat("я", 37)} {
+		if _, err := h.Hash(password); !errors.Is(err, ErrPasswordTooLong) {
+			t.Errorf("Hash(%d bytes): err = %v, want ErrPasswordTooLong", len(password), err)
+		}
+	}
+	if got := newHasher(t, Argon2id, testArgon2Params, bcrypt.MinCost).MaxPasswordBytes(); got != 0 {
+		t.Fatalf("argon2id MaxPasswordBytes = %d, want 0", got)
+	}
+}
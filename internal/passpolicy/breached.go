@@ -0,0 +1,77 @@
+package passpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// BreachedList — SHA-1 утёкших паролей в памяти, отсортированные для
+// двоичного поиска: 20 байт на пароль, миллион паролей — около 20 МБ.
+type BreachedList struct {
+	hashes [][sha1.Size]byte
+}
+
+// LoadBreachedList читает файл, где каждая строка — SHA-1 пароля в hex
+// (формат Have I Been Pwned, "<SHA-1>:<count>", подходит как есть) либо
+// сам пароль открытым текстом. Порядок строк не важен.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	var hashes [][sha1.Size]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if h, ok := parseSHA1Line(line); ok {
+			hashes = append(hashes, h)
+			continue
+		}
+		hashes = append(hashes, sha1.Sum([]byte(line)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	slices.SortFunc(hashes, compareHashes)
+	return &BreachedList{hashes: slices.Compact(hashes)}, nil
+}
+
+func parseSHA1Line(line string) ([sha1.Size]byte, bool) {
+	var h [sha1.Size]byte
+	digest, rest, _ := strings.Cut(line, ":")
+	if len(digest) != hex.EncodedLen(sha1.Size) {
+		return h, false
+	}
+	if rest != "" && strings.Trim(rest, "0123456789") != "" {
+		return h, false
+	}
+	if _, err := hex.Decode(h[:], []byte(digest)); err != nil {
+		return h, false
+	}
+	return h, true
+}
+
+func compareHashes(a, b [sha1.Size]byte) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	_, found := slices.BinarySearchFunc(l.hashes, sha1.Sum([]byte(password)), compareHashes)
+	return found
+}
+
+func (l *BreachedList) Len() int {
+	return len(l.hashes)
+}
@@ -0,0 +1,64 @@
+package passpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeBreachedList(t *testing.T, content string) *BreachedList {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write breached list: %v", err)
+	}
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedList: %v", err)
+	}
+	return list
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBreachedList(t *testing.T) {
+	lines := []string{
+		// формат Have I Been Pwned: SHA-1 заглавными и число утечек
+		strings.ToUpper(sha1Hex("password")) + ":3730471",
+		sha1Hex("123456"),
+		"hunter2",
+		"qwerty\r",
+		"",
+		"hunter2",
+		// не SHA-1: хеш с мусором после двоеточия и короткий hex — это пароли
+		sha1Hex("letmein") + ":many",
+		"deadbeef",
+	}
+	list := writeBreachedList(t, strings.Join(lines, "\n"))
+
+	if list.Len() != 6 {
+		t.Fatalf("Len = %d, want 6 (empty line and duplicate skipped)", list.Len())
+	}
+	for _, password := range []string{"password", "123456", "hunter2", "qwerty", "deadbeef", sha1Hex("letmein") + ":many"} {
+		if !list.Contains(password) {
+			t.Errorf("Contains(%q) = false", password)
+		}
+	}
+	for _, password := range []string{"Password", "hunter3", "letmein", "qwerty\r", ""} {
+		if list.Contains(password) {
+			t.Errorf("Contains(%q) = true", password)
+		}
+	}
+}
+
+func TestLoadBreachedListMissingFile(t *testing.T) {
+	if _, err := LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("LoadBreachedList accepted a missing file")
+	}
+}
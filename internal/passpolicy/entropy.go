@@ -0,0 +1,39 @@
+package passpolicy
+
+import "math"
+
+// Размер алфавита для каждого класса символов.
+var classPool = map[int]float64{
+	classLower: 26,
+	classUpper: 26,
+	classDigit: 10,
+	classOther: 33,
+}
+
+// entropyBits грубо оценивает энтропию пароля: число символов × log2 размера
+// алфавита из встреченных классов. Повтор предыдущего символа и шаг на единицу
+// (aaa, 123, abc, cba) считаются за четверть символа.
+func entropyBits(password string) float64 {
+	var mask int
+	var length float64
+	prev := rune(-1)
+	for _, r := range password {
+		mask |= charClass(r)
+		if d := r - prev; prev >= 0 && d >= -1 && d <= 1 {
+			length += 0.25
+		} else {
+			length++
+		}
+		prev = r
+	}
+	var pool float64
+	for class, size := range classPool {
+		if mask&class != 0 {
+			pool += size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return length * math.Log2(pool)
+}
@@ -0,0 +1,196 @@
+// Package passpolicy проверяет новые пароли: длина, классы символов,
+// отсутствие логина и email, оценка энтропии и поиск в локальном списке
+// утёкших паролей. Check возвращает все нарушенные правила сразу.
+package passpolicy
+
+import (
+	"fmt"
+	"friend-help/internal/errs"
+	"log/slog"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Правила, которые попадают в errs.PasswordViolation.Rule.
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleCharClasses = "char_classes"
+	RuleUserData    = "user_data"
+	RuleEntropy     = "entropy"
+	RuleBreached    = "breached"
+	RuleHistory     = "history" // проверяет сервис: нужна история паролей из БД
+)
+
+// MaxLengthLimit — верхняя граница PASSWORD_MAX_LENGTH; с ней согласованы
+// теги binding:"max=256" на полях паролей в запросах.
+const MaxLengthLimit = 256
+
+// minUserDataLength — части логина и email короче этого не ищутся в пароле,
+// иначе логин "al" запрещал бы любой пароль с "al".
+const minUserDataLength = 3
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes — предел длины в байтах от алгоритма хеширования (bcrypt — 72);
+	// 0 — без предела.
+	MaxBytes int
+	// MinClasses — сколько классов символов (строчные, заглавные, цифры, прочие)
+	// должно встретиться в пароле.
+	MinClasses     int
+	MinEntropyBits float64
+	ForbidUserData bool
+	// Breached — список утёкших паролей; nil отключает проверку.
+	Breached *BreachedList
+}
+
+var DefaultPolicy = Policy{
+	MinLength:      8,
+	MaxLength:      128,
+	MinClasses:     1,
+	MinEntropyBits: 35,
+	ForbidUserData: true,
+}
+
+// LoadFromEnv читает PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH,
+// PASSWORD_MIN_CHAR_CLASSES, PASSWORD_MIN_ENTROPY_BITS, PASSWORD_FORBID_USER_DATA
+// и PASSWORD_BREACHED_FILE; пустая переменная — значение по умолчанию.
+func LoadFromEnv() (*Policy, error) {
+	p := DefaultPolicy
+	var err error
+	if p.MinLength, err = envInt("PASSWORD_MIN_LENGTH", p.MinLength); err != nil {
+		return nil, err
+	}
+	if p.MaxLength, err = envInt("PASSWORD_MAX_LENGTH", p.MaxLength); err != nil {
+		return nil, err
+	}
+	if p.MinLength < 1 || p.MaxLength < p.MinLength || p.MaxLength > MaxLengthLimit {
+		return nil, fmt.Errorf("bad password length limits %d..%d: want 1 <= PASSWORD_MIN_LENGTH <= PASSWORD_MAX_LENGTH <= %d", p.MinLength, p.MaxLength, MaxLengthLimit)
+	}
+	if p.MinClasses, err = envInt("PASSWORD_MIN_CHAR_CLASSES", p.MinClasses); err != nil {
+		return nil, err
+	}
+	if p.MinClasses > 4 {
+		return nil, fmt.Errorf("var PASSWORD_MIN_CHAR_CLASSES must be at most 4, got %d", p.MinClasses)
+	}
+	if v := os.Getenv("PASSWORD_MIN_ENTROPY_BITS"); v != "" {
+		bits, err := strconv.ParseFloat(v, 64)
+		if err != nil || bits < 0 {
+			return nil, fmt.Errorf("var PASSWORD_MIN_ENTROPY_BITS bad format: %q", v)
+		}
+		p.MinEntropyBits = bits
+	}
+	if v := os.Getenv("PASSWORD_FORBID_USER_DATA"); v != "" {
+		forbid, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("var PASSWORD_FORBID_USER_DATA bad format: %q", v)
+		}
+		p.ForbidUserData = forbid
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		list, err := LoadBreachedList(path)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("breached password list loaded", "path", path, "entries", list.Len())
+		p.Breached = list
+	}
+	return &p, nil
+}
+
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("var %s bad format: %q", name, v)
+	}
+	return n, nil
+}
+
+// Check проверяет пароль по всем правилам. userData — логин, email и другие
+// данные пользователя, которых не должно быть в пароле. Нарушения
+// возвращаются одной ошибкой *errs.PasswordPolicyError.
+func (p *Policy) Check(password string, userData ...string) error {
+	var violations []errs.PasswordViolation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, errs.PasswordViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(RuleMinLength, "password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "password must be at most %d characters long", p.MaxLength)
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add(RuleMaxLength, "password must be at most %d bytes long", p.MaxBytes)
+	}
+	if classes := countClasses(password); classes < p.MinClasses {
+		add(RuleCharClasses, "password must contain at least %d of: lowercase letters, uppercase letters, digits, other characters", p.MinClasses)
+	}
+	if p.ForbidUserData && containsUserData(password, userData) {
+		add(RuleUserData, "password must not contain the login or email")
+	}
+	if p.MinEntropyBits > 0 && entropyBits(password) < p.MinEntropyBits {
+		add(RuleEntropy, "password is too predictable, use a longer password or more kinds of characters")
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		add(RuleBreached, "password appears in a list of breached passwords")
+	}
+	if len(violations) > 0 {
+		return &errs.PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func containsUserData(password string, userData []string) bool {
+	lower := strings.ToLower(password)
+	for _, data := range userData {
+		data = strings.ToLower(data)
+		candidates := []string{data}
+		if local, _, ok := strings.Cut(data, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, c := range candidates {
+			if utf8.RuneCountInString(c) >= minUserDataLength && strings.Contains(lower, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	classLower = 1 << iota
+	classUpper
+	classDigit
+	classOther
+)
+
+func charClass(r rune) int {
+	switch {
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsDigit(r):
+		return classDigit
+	default:
+		return classOther
+	}
+}
+
+func countClasses(password string) int {
+	var mask int
+	for _, r := range password {
+		mask |= charClass(r)
+	}
+	return bits.OnesCount(uint(mask))
+}
@@ -0,0 +1,163 @@
+package passpolicy
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *errs.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want *errs.PasswordPolicyError", err)
+	}
+	if !errors.Is(err, errs.ErrWeakPassword) {
+		t.Fatalf("err = %v does not wrap ErrWeakPassword", err)
+	}
+	var rules []string
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestCheck(t *testing.T) {
+	breached := writeBreachedList(t, "Tr0ub4dor&3\n")
+	withBytes := DefaultPolicy
+	withBytes.MaxBytes = 72
+	threeClasses := DefaultPolicy
+	threeClasses.MinClasses = 3
+	allowUserData := DefaultPolicy
+	allowUserData.ForbidUserData = false
+	withBreached := DefaultPolicy
+	withBreached.Breached = breached
+
+	cases := []struct {
+		name     string
+		policy   Policy
+		password string
+		userData []string
+		want     []string
+	}{
+		{"strong", DefaultPolicy, "Tr0ub4dor&3", nil, nil},
+		{"short and weak", DefaultPolicy, "abcde", nil, []string{RuleMinLength, RuleEntropy}},
+		{"length counts runes", DefaultPolicy, "пароль-ёж", nil, nil},
+		{"too long", DefaultPolicy, strings.Repeat("Xy3!", 33), nil, []string{RuleMaxLength}},
+		{"at max length", DefaultPolicy, strings.Repeat("Xy3!", 32), nil, nil},
+		{"over bcrypt bytes", withBytes, strings.Repeat("пароль", 7), nil, []string{RuleMaxLength}},
+		{"at bcrypt bytes", withBytes, strings.Repeat("пароль", 6), nil, nil},
+		{"repeated characters", DefaultPolicy, "aaaaaaaaaaaa", nil, []string{RuleEntropy}},
+		{"sequence", DefaultPolicy, "123456789012", nil, []string{RuleEntropy}},
+		{"too few classes", threeClasses, "correcthorsebattery", nil, []string{RuleCharClasses}},
+		{"enough classes", threeClasses, "Correct-horse-battery", nil, nil},
+		{"login any case", DefaultPolicy, "xIVANOVx-Secret-42", []string{"ivanov", "ivanov@example.com"}, []string{RuleUserData}},
+		{"email local part", DefaultPolicy, "Petrov.k-Secret-42", []string{"someone", "petrov.k@example.com"}, []string{RuleUserData}},
+		{"short login ignored", DefaultPolicy, "Tr0ub4dor&3al", []string{"al"}, nil},
+		{"user data allowed", allowUserData, "xIVANOVx-Secret-42", []string{"ivanov"}, nil},
+		{"breached", withBreached, "Tr0ub4dor&3", nil, []string{RuleBreached}},
+		{"not breached", withBreached, "Tr0ub4dor&4", nil, nil},
+		{"all at once", withBreached, "ivan", []string{"ivan"}, []string{RuleMinLength, RuleUserData, RuleEntropy}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := violatedRules(t, tc.policy.Check(tc.password, tc.userData...))
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("Check(%q) rules = %v, want %v", tc.password, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckMaxBytesMessage(t *testing.T) {
+	p := DefaultPolicy
+	p.MaxBytes = 72
+	err := p.Check(strings.Repeat("пароль", 7))
+	if err == nil || !strings.Contains(err.Error(), "at most 72 bytes") {
+		t.Fatalf("Check error = %v, want the byte limit in the message", err)
+	}
+}
+
+func TestEntropyBits(t *testing.T) {
+	lower, digits, all := math.Log2(26), math.Log2(10), math.Log2(95)
+	cases := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"q", lower},
+		{"qwzx", 4 * lower},
+		// повтор и шаг на единицу — четверть символа
+		{"aaaa", 1.75 * lower},
+		{"abcd", 1.75 * lower},
+		{"dcba", 1.75 * lower},
+		{"1357", 4 * digits},
+		{"1234", 1.75 * digits},
+		{"aZ9!", 4 * all},
+	}
+	for _, tc := range cases {
+		if got := entropyBits(tc.password); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("entropyBits(%q) = %.2f, want %.2f", tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	vars := []string{
+		"PASSWORD_MIN_LENGTH", "PASSWORD_MAX_LENGTH", "PASSWORD_MIN_CHAR_CLASSES",
+		"PASSWORD_MIN_ENTROPY_BITS", "PASSWORD_FORBID_USER_DATA", "PASSWORD_BREACHED_FILE",
+	}
+	for _, v := range vars {
+		t.Setenv(v, "")
+	}
+	p, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv with defaults: %v", err)
+	}
+	if *p != DefaultPolicy {
+		t.Fatalf("LoadFromEnv = %+v, want DefaultPolicy", *p)
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("hunter22\n"), 0o600); err != nil {
+		t.Fatalf("write breached list: %v", err)
+	}
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_MIN_ENTROPY_BITS", "50.5")
+	t.Setenv("PASSWORD_FORBID_USER_DATA", "false")
+	t.Setenv("PASSWORD_BREACHED_FILE", path)
+	p, err = LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if p.MinLength != 12 || p.MinEntropyBits != 50.5 || p.ForbidUserData || p.Breached.Len() != 1 {
+		t.Fatalf("LoadFromEnv = %+v", *p)
+	}
+
+	bad := []struct{ name, value string }{
+		{"PASSWORD_MIN_LENGTH", "eight"},
+		{"PASSWORD_MIN_LENGTH", "0"},
+		{"PASSWORD_MAX_LENGTH", "8"},
+		{"PASSWORD_MAX_LENGTH", "257"},
+		{"PASSWORD_MIN_CHAR_CLASSES", "5"},
+		{"PASSWORD_MIN_ENTROPY_BITS", "-1"},
+		{"PASSWORD_FORBID_USER_DATA", "maybe"},
+		{"PASSWORD_BREACHED_FILE", filepath.Join(t.TempDir(), "missing.txt")},
+	}
+	for _, b := range bad {
+		t.Run(b.name+"="+b.value, func(t *testing.T) {
+			t.Setenv(b.name, b.value)
+			if _, err := LoadFromEnv(); err == nil {
+				t.Fatalf("LoadFromEnv accepted %s=%q", b.name, b.value)
+			}
+		})
+	}
+}
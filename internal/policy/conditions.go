@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type operator func(attr, value interface{}) bool
+
+// operators — допустимые значения op. Отсутствующий атрибут или значение
+// несравнимого типа делают условие ложным, в том числе для deny-политик.
+var operators = map[string]operator{
+	"eq":       equal,
+	"ne":       func(a, v interface{}) bool { return !equal(a, v) },
+	"in":       func(a, v interface{}) bool { return contains(v, a) },
+	"not_in":   func(a, v interface{}) bool { return !contains(v, a) },
+	"contains": contains,
+	"gt":       func(a, v interface{}) bool { return compare(a, v, func(x, y float64) bool { return x > y }) },
+	"gte":      func(a, v interface{}) bool { return compare(a, v, func(x, y float64) bool { return x >= y }) },
+	"lt":       func(a, v interface{}) bool { return compare(a, v, func(x, y float64) bool { return x < y }) },
+	"lte":      func(a, v interface{}) bool { return compare(a, v, func(x, y float64) bool { return x <= y }) },
+	"exists":   func(a, v interface{}) bool { return true },
+	// cidr и not_cidr обрабатываются в eval через заранее разобранные сети
+	"cidr":     nil,
+	"not_cidr": nil,
+}
+
+func (c *Condition) eval(in Input) bool {
+	attr, ok := in.lookup(c.Attr)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case "cidr":
+		return inNets(attr, c.nets)
+	case "not_cidr":
+		ip := net.ParseIP(fmt.Sprint(attr))
+		return ip != nil && !inNets(attr, c.nets)
+	}
+	value := c.Value
+	if c.ValueFrom != "" {
+		if value, ok = in.lookup(c.ValueFrom); !ok {
+			return false
+		}
+	}
+	return operators[c.Op](attr, value)
+}
+
+// equal сравнивает числа как числа, даже если одно из них пришло строкой
+// (например, id из пути запроса против user_id из токена).
+func equal(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func contains(list, item interface{}) bool {
+	for _, v := range asList(list) {
+		if equal(v, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(a, b interface{}, cmp func(x, y float64) bool) bool {
+	x, ok := toNumber(a)
+	if !ok {
+		return false
+	}
+	y, ok := toNumber(b)
+	if !ok {
+		return false
+	}
+	return cmp(x, y)
+}
+
+func inNets(attr interface{}, nets []*net.IPNet) bool {
+	ip := net.ParseIP(fmt.Sprint(attr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func asList(v interface{}) []interface{} {
+	switch list := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return list
+	case []string:
+		out := make([]interface{}, len(list))
+		for i, s := range list {
+			out[i] = s
+		}
+		return out
+	default:
+		return []interface{}{v}
+	}
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
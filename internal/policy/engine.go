@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/model"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPolicyReloadSeconds = 30
+
+// Input — всё, что известно о запросе на момент проверки.
+type Input struct {
+	Action   string
+	Subject  map[string]interface{}
+	Resource map[string]interface{}
+	Request  map[string]interface{}
+}
+
+type Decision struct {
+	Allowed  bool
+	PolicyID string
+}
+
+// SubjectFromClaims превращает claims access-токена в атрибуты subject.*.
+func SubjectFromClaims(claims *model.AuthClaims) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":     claims.UserID,
+		"role":        claims.Role,
+		"role_name":   model.RoleNames[claims.Role],
+		"permissions": claims.Permissions(),
+		"sid":         claims.SessionID,
+	}
+}
+
+func (in Input) lookup(attr string) (interface{}, bool) {
+	ns, path, _ := strings.Cut(attr, ".")
+	var current interface{}
+	switch ns {
+	case "subject":
+		current = in.Subject
+	case "resource":
+		current = in.Resource
+	case "request":
+		current = in.Request
+	}
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+type Engine struct {
+	mu       sync.RWMutex
+	policies []Policy
+
+	path    string
+	modTime time.Time
+}
+
+// NewEngineFromEnv загружает политики из POLICY_FILE. Без файла движок
+// пуст и запрещает любое действие.
+func NewEngineFromEnv() (*Engine, error) {
+	e := &Engine{path: os.Getenv("POLICY_FILE")}
+	if e.path == "" {
+		return e, nil
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Enabled сообщает, задан ли POLICY_FILE. Пустой движок запрещает всё,
+// поэтому маршруты, где политики необязательны, проверяют его заранее.
+func (e *Engine) Enabled() bool {
+	return e.path != ""
+}
+
+// Reload перечитывает файл политик. При ошибке остаются прежние политики.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat policy file: %w", err)
+	}
+	policies, err := LoadFile(e.path)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.policies = policies
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+	return nil
+}
+
+// Evaluate применяет политики к in: подходящая deny-политика побеждает,
+// иначе решает первая подходящая allow-политика, иначе доступ запрещён.
+func (e *Engine) Evaluate(in Input) Decision {
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+	var allowed *Policy
+	for i := range policies {
+		p := &policies[i]
+		if !p.matchAction(in.Action) || !p.matchConditions(in) {
+			continue
+		}
+		if p.Effect == Deny {
+			return Decision{Allowed: false, PolicyID: p.ID}
+		}
+		if allowed == nil {
+			allowed = p
+		}
+	}
+	if allowed == nil {
+		return Decision{}
+	}
+	return Decision{Allowed: true, PolicyID: allowed.ID}
+}
+
+// Watch запускает фоновую перезагрузку файла политик при изменении mtime.
+func (e *Engine) Watch(ctx context.Context) error {
+	if e.path == "" {
+		return nil
+	}
+	seconds := defaultPolicyReloadSeconds
+	if v := os.Getenv("POLICY_RELOAD_SECONDS"); v != "" {
+		var err error
+		seconds, err = strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("var POLICY_RELOAD_SECONDS bad format: %q", v)
+		}
+	}
+	go e.watch(ctx, time.Duration(seconds)*time.Second)
+	return nil
+}
+
+func (e *Engine) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(e.path)
+			if err != nil {
+				slog.Error("policy file is unavailable", "error", err)
+				continue
+			}
+			e.mu.RLock()
+			changed := !info.ModTime().Equal(e.modTime)
+			e.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := e.Reload(); err != nil {
+				slog.Error("failed to reload policies, keeping previous set", "error", err)
+				continue
+			}
+			slog.Info("policies reloaded", "path", e.path)
+		}
+	}
+}
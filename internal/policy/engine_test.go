@@ -0,0 +1,218 @@
+package policy
+
+import (
+	"context"
+	"friend-help/internal/model"
+	"os"
+	"testing"
+	"time"
+)
+
+const testPolicies = `
+policies:
+  - id: admins
+    effect: allow
+    actions: ["*"]
+    conditions:
+      - {attr: subject.role_name, op: eq, value: admin}
+  - id: owner-edit
+    effect: allow
+    actions: ["documents:update", "documents:delete"]
+    conditions:
+      - {attr: resource.owner_id, op: eq, value_from: subject.user_id}
+  - id: admin-office-only
+    effect: deny
+    actions: ["admin:*"]
+    conditions:
+      - {attr: subject.role_name, op: eq, value: admin}
+      - {attr: request.ip, op: not_cidr, value: ["10.0.0.0/8", "192.168.0.0/16"]}
+  - id: no-weekend-deletes
+    effect: deny
+    actions: ["documents:delete"]
+    conditions:
+      - {attr: request.weekday, op: in, value: [Saturday, Sunday]}
+  - id: business-hours-reports
+    effect: allow
+    actions: ["reports:read"]
+    conditions:
+      - {attr: subject.permissions, op: contains, value: "reports:read"}
+      - {attr: request.hour, op: gte, value: 9}
+      - {attr: request.hour, op: lt, value: 18}
+`
+
+func newTestEngine(t *testing.T, content string) *Engine {
+	t.Helper()
+	e := &Engine{path: writePolicyFile(t, "policies.yaml", content)}
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	return e
+}
+
+func subject(userID, role int, scope string) map[string]interface{} {
+	return SubjectFromClaims(&model.AuthClaims{UserID: userID, Role: role, Scope: scope})
+}
+
+func TestEvaluate(t *testing.T) {
+	e := newTestEngine(t, testPolicies)
+	weekday := map[string]interface{}{"ip": "10.0.0.1", "hour": 12, "weekday": "Tuesday"}
+	cases := []struct {
+		name     string
+		in       Input
+		allowed  bool
+		policyID string
+	}{
+		{
+			name:     "owner edits own document",
+			in:       Input{Action: "documents:update", Subject: subject(42, model.Member, ""), Resource: map[string]interface{}{"owner_id": "42"}, Request: weekday},
+			allowed:  true,
+			policyID: "owner-edit",
+		},
+		{
+			name: "other user's document",
+			in:   Input{Action: "documents:update", Subject: subject(7, model.Member, ""), Resource: map[string]interface{}{"owner_id": "42"}, Request: weekday},
+		},
+		{
+			name: "resource without owner",
+			in:   Input{Action: "documents:update", Subject: subject(42, model.Member, ""), Request: weekday},
+		},
+		{
+			name:     "first matching allow wins",
+			in:       Input{Action: "documents:update", Subject: subject(42, model.Admin, ""), Resource: map[string]interface{}{"owner_id": 42}, Request: weekday},
+			allowed:  true,
+			policyID: "admins",
+		},
+		{
+			name:     "deny beats allow",
+			in:       Input{Action: "documents:delete", Subject: subject(42, model.Member, ""), Resource: map[string]interface{}{"owner_id": 42}, Request: map[string]interface{}{"weekday": "Sunday"}},
+			policyID: "no-weekend-deletes",
+		},
+		{
+			name:     "deny listed after allow still wins",
+			in:       Input{Action: "admin:roles.assign", Subject: subject(1, model.Admin, ""), Request: map[string]interface{}{"ip": "203.0.113.7"}},
+			policyID: "admin-office-only",
+		},
+		{
+			name:     "admin from office network",
+			in:       Input{Action: "admin:roles.assign", Subject: subject(1, model.Admin, ""), Request: map[string]interface{}{"ip": "192.168.1.10"}},
+			allowed:  true,
+			policyID: "admins",
+		},
+		{
+			// без request.ip deny-условие ложно: отсутствующий атрибут не совпадает ни с чем
+			name:     "deny needs its attributes",
+			in:       Input{Action: "admin:roles.assign", Subject: subject(1, model.Admin, "")},
+			allowed:  true,
+			policyID: "admins",
+		},
+		{
+			name:     "reports during business hours",
+			in:       Input{Action: "reports:read", Subject: subject(5, model.Moderator, "users:read reports:read"), Request: weekday},
+			allowed:  true,
+			policyID: "business-hours-reports",
+		},
+		{
+			name: "reports after hours",
+			in:   Input{Action: "reports:read", Subject: subject(5, model.Moderator, "reports:read"), Request: map[string]interface{}{"hour": 18}},
+		},
+		{
+			name: "reports without permission",
+			in:   Input{Action: "reports:read", Subject: subject(5, model.Member, "profile:read"), Request: weekday},
+		},
+		{
+			name: "no matching policy",
+			in:   Input{Action: "users:delete", Subject: subject(5, model.Moderator, "users:read"), Request: weekday},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := e.Evaluate(tc.in)
+			if got.Allowed != tc.allowed || got.PolicyID != tc.policyID {
+				t.Fatalf("Evaluate = %+v, want {Allowed:%v PolicyID:%s}", got, tc.allowed, tc.policyID)
+			}
+		})
+	}
+}
+
+func TestEmptyEngineDeniesEverything(t *testing.T) {
+	t.Setenv("POLICY_FILE", "")
+	e, err := NewEngineFromEnv()
+	if err != nil {
+		t.Fatalf("NewEngineFromEnv: %v", err)
+	}
+	if e.Enabled() {
+		t.Fatal("engine without POLICY_FILE reports Enabled")
+	}
+	if d := e.Evaluate(Input{Action: "documents:read", Subject: subject(1, model.Admin, "")}); d.Allowed {
+		t.Fatalf("empty engine allowed %+v", d)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	e := newTestEngine(t, testPolicies)
+	in := Input{Action: "reports:read", Subject: subject(5, model.Moderator, "reports:read"), Request: map[string]interface{}{"hour": 20}}
+	if e.Evaluate(in).Allowed {
+		t.Fatal("reports allowed after hours before reload")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.watch(ctx, 10*time.Millisecond)
+
+	replace := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(e.path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write policies: %v", err)
+		}
+		// mtime задаём явно: на части ФС его точность — секунда
+		if err := os.Chtimes(e.path, mtime, mtime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	waitFor := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for e.Evaluate(in).Allowed != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Evaluate().Allowed did not become %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	base := time.Now().Add(time.Hour)
+	replace(`
+policies:
+  - id: reports-any-time
+    effect: allow
+    actions: ["reports:read"]
+`, base)
+	waitFor(true)
+	if d := e.Evaluate(in); d.PolicyID != "reports-any-time" {
+		t.Fatalf("PolicyID = %q after reload", d.PolicyID)
+	}
+
+	// сломанный файл не применяется: остаются прежние политики
+	replace("policies: [", base.Add(time.Hour))
+	time.Sleep(50 * time.Millisecond)
+	if !e.Evaluate(in).Allowed {
+		t.Fatal("broken policy file replaced the previous set")
+	}
+
+	replace(testPolicies, base.Add(2*time.Hour))
+	waitFor(false)
+}
+
+func TestReloadKeepsPoliciesOnError(t *testing.T) {
+	e := newTestEngine(t, testPolicies)
+	if err := os.WriteFile(e.path, []byte("policies:\n  - {id: x, effect: maybe, actions: [y]}\n"), 0o600); err != nil {
+		t.Fatalf("write policies: %v", err)
+	}
+	if err := e.Reload(); err == nil {
+		t.Fatal("Reload accepted an invalid policy")
+	}
+	in := Input{Action: "documents:update", Subject: subject(42, model.Member, ""), Resource: map[string]interface{}{"owner_id": 42}}
+	if d := e.Evaluate(in); !d.Allowed || d.PolicyID != "owner-edit" {
+		t.Fatalf("Evaluate after failed reload = %+v", d)
+	}
+}
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"friend-help/internal/errs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Document — формат файла POLICY_FILE (YAML или JSON, по расширению).
+//
+//	policies:
+//	  - id: owner-edit
+//	    effect: allow
+//	    actions: ["documents:update", "documents:delete"]
+//	    conditions:
+//	      - {attr: resource.owner_id, op: eq, value_from: subject.user_id}
+//	  - id: admin-office-only
+//	    effect: deny
+//	    actions: ["admin:*"]
+//	    conditions:
+//	      - {attr: subject.role_name, op: eq, value: admin}
+//	      - {attr: request.ip, op: not_cidr, value: ["10.0.0.0/8"]}
+//
+// Условия внутри политики объединяются через И. Запрещающая политика
+// важнее разрешающей; если не подошла ни одна — доступ запрещён.
+type Document struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+type Policy struct {
+	ID          string      `json:"id" yaml:"id"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Effect      Effect      `json:"effect" yaml:"effect"`
+	Actions     []string    `json:"actions" yaml:"actions"`
+	Conditions  []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// Condition сравнивает атрибут attr со значением value либо с другим
+// атрибутом value_from. Атрибуты адресуются как subject.*, resource.*, request.*.
+type Condition struct {
+	Attr      string      `json:"attr" yaml:"attr"`
+	Op        string      `json:"op" yaml:"op"`
+	Value     interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty" yaml:"value_from,omitempty"`
+
+	nets []*net.IPNet
+}
+
+var namespaces = map[string]bool{"subject": true, "resource": true, "request": true}
+
+// LoadFile читает и проверяет файл политик.
+func LoadFile(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var doc Document
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&doc)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		err = dec.Decode(&doc)
+	default:
+		return nil, fmt.Errorf("%w: unsupported policy file extension %q", errs.ErrInvalidPolicy, filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidPolicy, err)
+	}
+	if err := compile(doc.Policies); err != nil {
+		return nil, err
+	}
+	return doc.Policies, nil
+}
+
+// compile проверяет политики и заранее разбирает CIDR-сети.
+func compile(policies []Policy) error {
+	seen := make(map[string]bool, len(policies))
+	for i := range policies {
+		p := &policies[i]
+		if p.ID == "" {
+			return fmt.Errorf("%w: policy #%d without id", errs.ErrInvalidPolicy, i+1)
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("%w: duplicate policy id %q", errs.ErrInvalidPolicy, p.ID)
+		}
+		seen[p.ID] = true
+		if p.Effect != Allow && p.Effect != Deny {
+			return fmt.Errorf("%w: policy %q: effect must be allow or deny", errs.ErrInvalidPolicy, p.ID)
+		}
+		if len(p.Actions) == 0 {
+			return fmt.Errorf("%w: policy %q: no actions", errs.ErrInvalidPolicy, p.ID)
+		}
+		for k := range p.Conditions {
+			if err := p.Conditions[k].compile(); err != nil {
+				return fmt.Errorf("%w: policy %q: %w", errs.ErrInvalidPolicy, p.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Condition) compile() error {
+	if !validAttr(c.Attr) {
+		return fmt.Errorf("bad attr %q", c.Attr)
+	}
+	if _, ok := operators[c.Op]; !ok {
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	if c.ValueFrom != "" {
+		if c.Value != nil {
+			return fmt.Errorf("attr %q: value and value_from are mutually exclusive", c.Attr)
+		}
+		if !validAttr(c.ValueFrom) {
+			return fmt.Errorf("bad value_from %q", c.ValueFrom)
+		}
+	}
+	if c.Op == "cidr" || c.Op == "not_cidr" {
+		if c.ValueFrom != "" {
+			return fmt.Errorf("attr %q: %s needs a literal value", c.Attr, c.Op)
+		}
+		for _, v := range asList(c.Value) {
+			_, ipNet, err := net.ParseCIDR(fmt.Sprint(v))
+			if err != nil {
+				return fmt.Errorf("attr %q: %w", c.Attr, err)
+			}
+			c.nets = append(c.nets, ipNet)
+		}
+		if len(c.nets) == 0 {
+			return fmt.Errorf("attr %q: %s without networks", c.Attr, c.Op)
+		}
+	}
+	return nil
+}
+
+func validAttr(attr string) bool {
+	ns, rest, ok := strings.Cut(attr, ".")
+	return ok && rest != "" && namespaces[ns]
+}
+
+// matchAction поддерживает точное совпадение, "*" и префикс вида "documents:*".
+func (p *Policy) matchAction(action string) bool {
+	for _, pattern := range p.Actions {
+		if pattern == "*" || pattern == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchConditions(in Input) bool {
+	for i := range p.Conditions {
+		if !p.Conditions[i].eval(in) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePolicyFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	yamlPath := writePolicyFile(t, "policies.yaml", `
+policies:
+  - id: office
+    effect: deny
+    actions: ["admin:*"]
+    conditions:
+      - {attr: request.ip, op: not_cidr, value: ["10.0.0.0/8"]}
+`)
+	jsonPath := writePolicyFile(t, "policies.json", `{"policies": [
+		{"id": "office", "effect": "deny", "actions": ["admin:*"],
+		 "conditions": [{"attr": "request.ip", "op": "not_cidr", "value": ["10.0.0.0/8"]}]}
+	]}`)
+	for _, path := range []string{yamlPath, jsonPath} {
+		policies, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile(%s): %v", filepath.Base(path), err)
+		}
+		if len(policies) != 1 || len(policies[0].Conditions[0].nets) != 1 {
+			t.Fatalf("LoadFile(%s) = %+v, want one policy with a compiled network", filepath.Base(path), policies)
+		}
+	}
+}
+
+func TestLoadFileRejectsInvalidPolicies(t *testing.T) {
+	cases := []struct {
+		name, file, content, wantErr string
+	}{
+		{"extension", "policies.toml", ``, "unsupported policy file extension"},
+		{"unknown yaml field", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], rule: y}\n", "field rule not found"},
+		{"unknown json field", "p.json", `{"policies": [{"id": "a", "effect": "allow", "actions": ["x"], "rule": "y"}]}`, "unknown field"},
+		{"missing id", "p.yaml", "policies:\n  - {effect: allow, actions: [x]}\n", "without id"},
+		{"duplicate id", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x]}\n  - {id: a, effect: deny, actions: [y]}\n", "duplicate policy id"},
+		{"bad effect", "p.yaml", "policies:\n  - {id: a, effect: permit, actions: [x]}\n", "effect must be allow or deny"},
+		{"no actions", "p.yaml", "policies:\n  - {id: a, effect: allow}\n", "no actions"},
+		{"bad namespace", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: user.id, op: exists}]}\n", "bad attr"},
+		{"unknown op", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: subject.role, op: like, value: 1}]}\n", "unknown op"},
+		{"value and value_from", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: resource.owner_id, op: eq, value: 1, value_from: subject.user_id}]}\n", "mutually exclusive"},
+		{"bad value_from", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: resource.owner_id, op: eq, value_from: user_id}]}\n", "bad value_from"},
+		{"cidr from attr", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: request.ip, op: cidr, value_from: resource.net}]}\n", "needs a literal value"},
+		{"bad cidr", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: request.ip, op: cidr, value: [10.0.0.1]}]}\n", "invalid CIDR"},
+		{"empty cidr", "p.yaml", "policies:\n  - {id: a, effect: allow, actions: [x], conditions: [{attr: request.ip, op: cidr}]}\n", "without networks"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadFile(writePolicyFile(t, tc.file, tc.content))
+			if !errors.Is(err, errs.ErrInvalidPolicy) || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("LoadFile error = %v, want ErrInvalidPolicy containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestConditions(t *testing.T) {
+	in := Input{
+		Subject: map[string]interface{}{
+			"user_id":     42,
+			"role_name":   "moderator",
+			"permissions": []string{"users:read", "reports:read"},
+		},
+		Resource: map[string]interface{}{
+			"owner_id": "42",
+			"meta":     map[string]interface{}{"tier": "gold"},
+			"empty":    nil,
+		},
+		Request: map[string]interface{}{
+			"ip":      "10.1.2.3",
+			"hour":    9,
+			"weekday": "Saturday",
+		},
+	}
+	cases := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"eq string", Condition{Attr: "subject.role_name", Op: "eq", Value: "moderator"}, true},
+		{"eq number against string", Condition{Attr: "resource.owner_id", Op: "eq", Value: 42}, true},
+		{"value_from", Condition{Attr: "resource.owner_id", Op: "eq", ValueFrom: "subject.user_id"}, true},
+		{"value_from missing", Condition{Attr: "resource.owner_id", Op: "eq", ValueFrom: "subject.sid"}, false},
+		{"nested attr", Condition{Attr: "resource.meta.tier", Op: "eq", Value: "gold"}, true},
+		{"ne", Condition{Attr: "subject.role_name", Op: "ne", Value: "admin"}, true},
+		{"in", Condition{Attr: "subject.role_name", Op: "in", Value: []interface{}{"admin", "moderator"}}, true},
+		{"not_in", Condition{Attr: "subject.role_name", Op: "not_in", Value: []interface{}{"admin"}}, true},
+		{"contains", Condition{Attr: "subject.permissions", Op: "contains", Value: "reports:read"}, true},
+		{"contains absent", Condition{Attr: "subject.permissions", Op: "contains", Value: "users:delete"}, false},
+		{"exists", Condition{Attr: "resource.meta", Op: "exists"}, true},
+		{"exists on nil", Condition{Attr: "resource.empty", Op: "exists"}, false},
+		{"hour gte", Condition{Attr: "request.hour", Op: "gte", Value: 9}, true},
+		{"hour lt", Condition{Attr: "request.hour", Op: "lt", Value: 9}, false},
+		{"hour gt string value", Condition{Attr: "request.hour", Op: "gt", Value: "8"}, true},
+		{"compare non-number", Condition{Attr: "subject.role_name", Op: "gt", Value: 1}, false},
+		{"weekend", Condition{Attr: "request.weekday", Op: "in", Value: []interface{}{"Saturday", "Sunday"}}, true},
+		{"cidr inside", Condition{Attr: "request.ip", Op: "cidr", Value: []interface{}{"10.0.0.0/8"}}, true},
+		{"cidr outside", Condition{Attr: "request.ip", Op: "cidr", Value: []interface{}{"192.168.0.0/16"}}, false},
+		{"not_cidr inside", Condition{Attr: "request.ip", Op: "not_cidr", Value: []interface{}{"10.0.0.0/8"}}, false},
+		{"not_cidr outside", Condition{Attr: "request.ip", Op: "not_cidr", Value: []interface{}{"192.168.0.0/16"}}, true},
+		{"not_cidr on non-ip", Condition{Attr: "subject.role_name", Op: "not_cidr", Value: []interface{}{"10.0.0.0/8"}}, false},
+		// отсутствующий атрибут делает ложным любое условие, даже отрицательное
+		{"missing eq", Condition{Attr: "resource.id", Op: "eq", Value: 1}, false},
+		{"missing ne", Condition{Attr: "resource.id", Op: "ne", Value: 1}, false},
+		{"missing not_in", Condition{Attr: "resource.id", Op: "not_in", Value: []interface{}{1}}, false},
+		{"missing not_cidr", Condition{Attr: "request.forwarded_ip", Op: "not_cidr", Value: []interface{}{"10.0.0.0/8"}}, false},
+		{"missing exists", Condition{Attr: "resource.id", Op: "exists"}, false},
+		{"path through scalar", Condition{Attr: "resource.owner_id.x", Op: "exists"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cond := tc.cond
+			if err := cond.compile(); err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if got := cond.eval(in); got != tc.want {
+				t.Fatalf("eval = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchAction(t *testing.T) {
+	p := Policy{Actions: []string{"documents:read", "admin:*"}}
+	cases := map[string]bool{
+		"documents:read":     true,
+		"documents:update":   false,
+		"admin:roles.assign": true,
+		"admin":              false,
+	}
+	for action, want := range cases {
+		if got := p.matchAction(action); got != want {
+			t.Errorf("matchAction(%q) = %v, want %v", action, got, want)
+		}
+	}
+	if !(&Policy{Actions: []string{"*"}}).matchAction("anything") {
+		t.Error(`"*" must match any action`)
+	}
+}
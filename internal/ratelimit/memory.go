@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memorySweepInterval = time.Minute
+
+type memoryWindow struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// MemoryLimiter — то же скользящее окно в памяти процесса.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{windows: make(map[string]*memoryWindow)}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	if !rule.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	now := time.Now()
+	key = rule.Name + ":" + key
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= memorySweepInterval {
+		l.sweep(now)
+	}
+	w, ok := l.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		l.windows[key] = w
+	}
+	w.window = rule.Window
+	w.hits = dropBefore(w.hits, now.Add(-rule.Window))
+	result := Result{Limit: rule.Limit}
+	if len(w.hits) < rule.Limit {
+		w.hits = append(w.hits, now)
+		result.Allowed = true
+	}
+	result.Remaining = rule.Limit - len(w.hits)
+	result.Reset = w.hits[0].Add(rule.Window).Sub(now)
+	return result, nil
+}
+
+// sweep удаляет окна, в которых не осталось действующих запросов.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if len(w.hits) == 0 || now.Sub(w.hits[len(w.hits)-1]) > w.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func dropBefore(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
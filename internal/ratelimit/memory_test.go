@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	rule := Rule{Name: "login", Limit: 3, Window: 300 * time.Millisecond}
+	ctx := context.Background()
+
+	if r, _ := limiter.Allow(ctx, "ip:a", rule); !r.Allowed || r.Remaining != 2 || r.Reset > rule.Window {
+		t.Fatalf("first request: %+v", r)
+	}
+	first := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if r, _ := limiter.Allow(ctx, "ip:a", rule); !r.Allowed {
+			t.Fatalf("request %d rejected: %+v", i+2, r)
+		}
+	}
+	r, _ := limiter.Allow(ctx, "ip:a", rule)
+	if r.Allowed || r.Remaining != 0 || r.Limit != rule.Limit {
+		t.Fatalf("request over the limit: %+v", r)
+	}
+	// место освобождается, когда из окна выходит самый старый запрос
+	if wantReset := time.Until(first.Add(rule.Window)); r.Reset <= 0 || r.Reset > wantReset {
+		t.Fatalf("Reset = %v, want in (0, %v]", r.Reset, wantReset)
+	}
+	if r, _ := limiter.Allow(ctx, "ip:b", rule); !r.Allowed {
+		t.Fatal("another client shares the counter")
+	}
+	if r, _ := limiter.Allow(ctx, "ip:a", Rule{Name: "register", Limit: 1, Window: time.Minute}); !r.Allowed {
+		t.Fatal("another rule shares the counter")
+	}
+
+	time.Sleep(r.Reset + 10*time.Millisecond)
+	if r, _ := limiter.Allow(ctx, "ip:a", rule); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("request after the oldest one expired: %+v", r)
+	}
+	// два запроса через 100 мс после первого ещё в окне
+	if r, _ := limiter.Allow(ctx, "ip:a", rule); r.Allowed {
+		t.Fatalf("window was reset instead of sliding: %+v", r)
+	}
+}
+
+func TestMemoryLimiterDisabledRule(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	for i := 0; i < 5; i++ {
+		if r, err := limiter.Allow(context.Background(), "ip:a", Rule{Name: "off"}); err != nil || !r.Allowed {
+			t.Fatalf("disabled rule: Allow = %+v, %v", r, err)
+		}
+	}
+	if len(limiter.windows) != 0 {
+		t.Fatalf("disabled rule created %d windows", len(limiter.windows))
+	}
+}
+
+func TestMemoryLimiterSweepsExpiredWindows(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	ctx := context.Background()
+	short := Rule{Name: "login", Limit: 5, Window: 10 * time.Millisecond}
+	long := Rule{Name: "register", Limit: 5, Window: time.Minute}
+	limiter.Allow(ctx, "ip:a", short)
+	limiter.Allow(ctx, "ip:b", long)
+	time.Sleep(20 * time.Millisecond)
+
+	limiter.lastSweep = time.Time{}
+	limiter.Allow(ctx, "ip:c", long)
+	if _, ok := limiter.windows["login:ip:a"]; ok {
+		t.Fatal("expired window was not swept")
+	}
+	if _, ok := limiter.windows["register:ip:b"]; !ok {
+		t.Fatal("live window was swept")
+	}
+}
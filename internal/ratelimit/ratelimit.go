@@ -0,0 +1,112 @@
+// Package ratelimit ограничивает частоту запросов скользящим окном:
+// не больше Limit запросов за любые Window. Счётчики хранятся в Redis
+// (общие для всех экземпляров сервиса) или в памяти процесса.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/cache"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset — через сколько освободится место в окне.
+	Reset time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+// Rule — лимит для группы маршрутов. Name входит в ключ счётчика,
+// поэтому у разных правил счётчики независимы. Limit == 0 отключает правило.
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+func (r Rule) Enabled() bool {
+	return r.Limit > 0
+}
+
+// ParseRule разбирает запись вида "20/1m" (20 запросов в минуту); "0" или "off"
+// отключает правило.
+func ParseRule(name, value string) (Rule, error) {
+	rule := Rule{Name: name}
+	value = strings.TrimSpace(value)
+	if value == "0" || value == "off" {
+		return rule, nil
+	}
+	limit, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return rule, fmt.Errorf("bad rate limit %q: want <requests>/<window>, e.g. 20/1m", value)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return rule, fmt.Errorf("bad rate limit %q: bad request count", value)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return rule, fmt.Errorf("bad rate limit %q: bad window", value)
+	}
+	rule.Limit, rule.Window = n, d
+	return rule, nil
+}
+
+// Rules — лимиты, которые навешиваются на группы маршрутов в NewHTTPServer.
+type Rules struct {
+	Auth     Rule // вся группа /api/auth, по IP
+	Login    Rule // вход по паролю и passkey, по IP
+	Register Rule // регистрация, по IP
+	Logout   Rule // выход, по IP
+	User     Rule // группа /api/user, по пользователю
+}
+
+// LoadRulesFromEnv читает RATE_LIMIT_AUTH, RATE_LIMIT_LOGIN, RATE_LIMIT_REGISTER,
+// RATE_LIMIT_LOGOUT и RATE_LIMIT_USER; пустая переменная — значение по умолчанию.
+func LoadRulesFromEnv() (Rules, error) {
+	var rules Rules
+	entries := []struct {
+		env, name, def string
+		dst            *Rule
+	}{
+		{"RATE_LIMIT_AUTH", "auth", "60/1m", &rules.Auth},
+		{"RATE_LIMIT_LOGIN", "login", "10/1m", &rules.Login},
+		{"RATE_LIMIT_REGISTER", "register", "5/1h", &rules.Register},
+		{"RATE_LIMIT_LOGOUT", "logout", "30/1m", &rules.Logout},
+		{"RATE_LIMIT_USER", "user", "300/1m", &rules.User},
+	}
+	for _, e := range entries {
+		value := os.Getenv(e.env)
+		if value == "" {
+			value = e.def
+		}
+		rule, err := ParseRule(e.name, value)
+		if err != nil {
+			return rules, fmt.Errorf("var %s bad format: %w", e.env, err)
+		}
+		*e.dst = rule
+	}
+	return rules, nil
+}
+
+// NewLimiterFromEnv выбирает хранилище по RATE_LIMIT_BACKEND: redis (по умолчанию)
+// или memory — для одного экземпляра сервиса.
+func NewLimiterFromEnv(redisService *cache.RedisService) (Limiter, error) {
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "redis":
+		return NewRedisLimiter(redisService, NewMemoryLimiter()), nil
+	case "memory":
+		return NewMemoryLimiter(), nil
+	default:
+		return nil, fmt.Errorf("var RATE_LIMIT_BACKEND bad format: %q", backend)
+	}
+}
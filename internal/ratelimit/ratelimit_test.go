@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    Rule
+		wantErr bool
+	}{
+		{value: "20/1m", want: Rule{Name: "r", Limit: 20, Window: time.Minute}},
+		{value: " 5/1h ", want: Rule{Name: "r", Limit: 5, Window: time.Hour}},
+		{value: "0", want: Rule{Name: "r"}},
+		{value: "off", want: Rule{Name: "r"}},
+		{value: "20", wantErr: true},
+		{value: "x/1m", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "20/minute", wantErr: true},
+		{value: "20/0s", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := ParseRule("r", tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseRule(%q) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestLoadRulesFromEnv(t *testing.T) {
+	for _, env := range []string{"RATE_LIMIT_AUTH", "RATE_LIMIT_LOGIN", "RATE_LIMIT_REGISTER", "RATE_LIMIT_LOGOUT", "RATE_LIMIT_USER"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("RATE_LIMIT_LOGIN", "3/30s")
+	t.Setenv("RATE_LIMIT_USER", "off")
+	rules, err := LoadRulesFromEnv()
+	if err != nil {
+		t.Fatalf("LoadRulesFromEnv: %v", err)
+	}
+	if rules.Login != (Rule{Name: "login", Limit: 3, Window: 30 * time.Second}) {
+		t.Errorf("Login = %+v", rules.Login)
+	}
+	if rules.Register != (Rule{Name: "register", Limit: 5, Window: time.Hour}) {
+		t.Errorf("Register default = %+v", rules.Register)
+	}
+	if rules.User.Enabled() {
+		t.Errorf("User = %+v, want disabled", rules.User)
+	}
+
+	t.Setenv("RATE_LIMIT_AUTH", "lots")
+	if _, err := LoadRulesFromEnv(); err == nil {
+		t.Fatal("LoadRulesFromEnv accepted a bad RATE_LIMIT_AUTH")
+	}
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const keyPrefix = "ratelimit:"
+
+// slidingWindow хранит метки запросов в sorted set и атомарно решает, пускать ли
+// очередной. Время берётся у Redis, чтобы часы экземпляров сервиса не расходились.
+// KEYS[1] — ключ окна; ARGV: окно в мс, лимит, уникальный member.
+// Возвращает {разрешено (0/1), осталось, мс до освобождения места}.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+// scripter — часть cache.RedisService, нужная для запуска Lua-скриптов.
+type scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
+}
+
+type RedisLimiter struct {
+	client   scripter
+	fallback Limiter
+}
+
+// NewRedisLimiter — лимитер в Redis. Если Redis недоступен, решение принимает
+// fallback (лимит действует в пределах одного экземпляра); nil — запрос пропускается.
+func NewRedisLimiter(client scripter, fallback Limiter) *RedisLimiter {
+	return &RedisLimiter{client: client, fallback: fallback}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	if !rule.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return Result{}, err
+	}
+	raw, err := slidingWindow.Run(ctx, l.client, []string{keyPrefix + rule.Name + ":" + key},
+		rule.Window.Milliseconds(), rule.Limit, hex.EncodeToString(member)).Int64Slice()
+	if err != nil {
+		err = fmt.Errorf("failed to run rate limit script: %w", err)
+		if l.fallback == nil {
+			return Result{Allowed: true, Limit: rule.Limit, Remaining: rule.Limit}, err
+		}
+		slog.WarnContext(ctx, "rate limiter falls back to memory", "rule", rule.Name, "error", err)
+		return l.fallback.Allow(ctx, key, rule)
+	}
+	return Result{
+		Allowed:   raw[0] == 1,
+		Limit:     rule.Limit,
+		Remaining: int(raw[1]),
+		Reset:     time.Duration(raw[2]) * time.Millisecond,
+	}, nil
+}
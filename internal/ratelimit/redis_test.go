@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newRedisLimiter — лимитер поверх miniredis; время Redis (TIME в скрипте)
+// задаётся через SetTime.
+func newRedisLimiter(t *testing.T, fallback Limiter) (*RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLimiter(client, fallback), server
+}
+
+type hit struct {
+	at        time.Duration // смещение от начала теста
+	allowed   bool
+	remaining int
+	reset     time.Duration
+}
+
+func TestRedisLimiterSlidingWindow(t *testing.T) {
+	limiter, server := newRedisLimiter(t, nil)
+	rule := Rule{Name: "login", Limit: 3, Window: time.Second}
+	start := time.Unix(1_700_000_000, 0)
+	hits := []hit{
+		{0, true, 2, time.Second},
+		{500 * time.Millisecond, true, 1, 500 * time.Millisecond},
+		{600 * time.Millisecond, true, 0, 400 * time.Millisecond},
+		{900 * time.Millisecond, false, 0, 100 * time.Millisecond},
+		// ровно через окно первый запрос уже не считается
+		{time.Second, true, 0, 500 * time.Millisecond},
+		{1100 * time.Millisecond, false, 0, 400 * time.Millisecond},
+		// отклонённые запросы не занимают место в окне
+		{1500 * time.Millisecond, true, 0, 100 * time.Millisecond},
+		{2600 * time.Millisecond, true, 2, time.Second},
+	}
+	for _, h := range hits {
+		server.SetTime(start.Add(h.at))
+		got, err := limiter.Allow(context.Background(), "ip:203.0.113.7", rule)
+		if err != nil {
+			t.Fatalf("at %v: Allow: %v", h.at, err)
+		}
+		want := Result{Allowed: h.allowed, Limit: rule.Limit, Remaining: h.remaining, Reset: h.reset}
+		if got != want {
+			t.Fatalf("at %v: Allow = %+v, want %+v", h.at, got, want)
+		}
+	}
+	if ttl := server.TTL(keyPrefix + "login:ip:203.0.113.7"); ttl != time.Second {
+		t.Fatalf("window key TTL = %v, want %v", ttl, time.Second)
+	}
+}
+
+func TestRedisLimiterSeparatesKeysAndRules(t *testing.T) {
+	limiter, server := newRedisLimiter(t, nil)
+	server.SetTime(time.Unix(1_700_000_000, 0))
+	ctx := context.Background()
+	login := Rule{Name: "login", Limit: 1, Window: time.Minute}
+	register := Rule{Name: "register", Limit: 1, Window: time.Minute}
+
+	if r, _ := limiter.Allow(ctx, "ip:a", login); !r.Allowed {
+		t.Fatal("first login request rejected")
+	}
+	if r, _ := limiter.Allow(ctx, "ip:a", login); r.Allowed {
+		t.Fatal("second login request allowed")
+	}
+	if r, _ := limiter.Allow(ctx, "ip:b", login); !r.Allowed {
+		t.Fatal("another client shares the login counter")
+	}
+	if r, _ := limiter.Allow(ctx, "ip:a", register); !r.Allowed {
+		t.Fatal("another rule shares the login counter")
+	}
+	if r, err := limiter.Allow(ctx, "ip:a", Rule{Name: "off"}); err != nil || !r.Allowed {
+		t.Fatalf("disabled rule: Allow = %+v, %v", r, err)
+	}
+}
+
+func TestRedisLimiterFallsBackWhenRedisFails(t *testing.T) {
+	rule := Rule{Name: "login", Limit: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	limiter, server := newRedisLimiter(t, NewMemoryLimiter())
+	server.Close()
+	for i, want := range []bool{true, true, false} {
+		r, err := limiter.Allow(ctx, "ip:a", rule)
+		if err != nil {
+			t.Fatalf("request %d: fallback returned error %v", i+1, err)
+		}
+		if r.Allowed != want {
+			t.Fatalf("request %d: Allowed = %v, want %v", i+1, r.Allowed, want)
+		}
+	}
+
+	// без fallback запрос пропускается, а ошибка уходит вызывающему
+	limiter, server = newRedisLimiter(t, nil)
+	server.Close()
+	r, err := limiter.Allow(ctx, "ip:a", rule)
+	if err == nil {
+		t.Fatal("Allow without Redis and fallback returned no error")
+	}
+	if !r.Allowed || r.Remaining != rule.Limit {
+		t.Fatalf("Allow without Redis and fallback = %+v, want allowed", r)
+	}
+}
@@ -1,44 +1,224 @@
-package repo
-
-import (
-	"database/sql"
-	"errors"
-	"fmt"
-	"friend-help/internal/errs"
-	"os"
-
-	_ "github.com/go-sql-driver/mysql"
-)
-
-func ConnectToBase() (*sql.DB, error) {
-	connStr := os.Getenv("DB_DSN")
-	if connStr == "" {
-		return nil, errors.New("var DB_DSN not found")
-	}
-	db, err := sql.Open("mysql", connStr)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToOpenDB, err)
-	}
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToPingDB, err)
-	}
-	return db, nil
-}
-
-func RunMigrations(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id INT PRIMARY KEY AUTO_INCREMENT,
-			login VARCHAR(32) NOT NULL UNIQUE,
-			username VARCHAR(32) NOT NULL,
-			email VARCHAR(100) NULL UNIQUE,
-			password_hash TEXT NOT NULL,
-			is_activated BOOLEAN NOT NULL DEFAULT true,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
-	}
-	return nil
-}
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func ConnectToBase() (*sql.DB, error) {
+	connStr := os.Getenv("DB_DSN")
+	if connStr == "" {
+		return nil, errors.New("var DB_DSN not found")
+	}
+	db, err := sql.Open("mysql", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToOpenDB, err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToPingDB, err)
+	}
+	return db, nil
+}
+
+var migrations = []string{
+	`
+		CREATE TABLE IF NOT EXISTS roles (
+			id INT PRIMARY KEY,
+			name VARCHAR(32) NOT NULL UNIQUE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		INSERT IGNORE INTO roles (id, name) VALUES
+			(1, 'member'),
+			(2, 'moderator'),
+			(3, 'admin');
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS users (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			login VARCHAR(32) NOT NULL UNIQUE,
+			username VARCHAR(32) NOT NULL,
+			email VARCHAR(100) NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			is_activated BOOLEAN NOT NULL DEFAULT true,
+			token_version INT NOT NULL DEFAULT 0,
+			role_id INT NOT NULL DEFAULT 1,
+			password_changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id CHAR(36) PRIMARY KEY,
+			user_id INT NOT NULL,
+			user_agent VARCHAR(255) NOT NULL DEFAULT '',
+			ip VARCHAR(45) NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP NULL,
+			INDEX idx_sessions_user (user_id),
+			CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS permissions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			name VARCHAR(64) NOT NULL UNIQUE,
+			description VARCHAR(255) NOT NULL DEFAULT ''
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS role_permissions (
+			role_id INT NOT NULL,
+			permission_id INT NOT NULL,
+			PRIMARY KEY (role_id, permission_id),
+			CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+			CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		INSERT IGNORE INTO permissions (name, description) VALUES
+			('profile:read', 'Просмотр своего профиля'),
+			('sessions:manage', 'Просмотр и завершение своих сессий'),
+			('users:read', 'Просмотр пользователей'),
+			('users:delete', 'Удаление пользователей'),
+			('roles:assign', 'Назначение ролей пользователям'),
+			('reports:read', 'Просмотр отчётов'),
+			('authz:check', 'Проверка доступа от имени пользователя с его IP');
+	`,
+	`
+		INSERT IGNORE INTO role_permissions (role_id, permission_id)
+		SELECT 1, id FROM permissions WHERE name IN ('profile:read', 'sessions:manage');
+	`,
+	`
+		INSERT IGNORE INTO role_permissions (role_id, permission_id)
+		SELECT 2, id FROM permissions WHERE name IN ('profile:read', 'sessions:manage', 'users:read', 'reports:read');
+	`,
+	`
+		INSERT IGNORE INTO role_permissions (role_id, permission_id)
+		SELECT 3, id FROM permissions;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS user_totp (
+			user_id INT PRIMARY KEY,
+			secret_enc VARBINARY(255) NOT NULL,
+			confirmed_at TIMESTAMP NULL,
+			last_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_user_totp_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			code_hash VARCHAR(60) NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_recovery_codes_user (user_id),
+			CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS webauthn_user_handles (
+			user_id INT PRIMARY KEY,
+			handle VARBINARY(64) NOT NULL UNIQUE,
+			CONSTRAINT fk_webauthn_handles_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			credential_id VARBINARY(1023) NOT NULL,
+			public_key BLOB NOT NULL,
+			attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+			transports VARCHAR(255) NOT NULL DEFAULT '',
+			aaguid VARBINARY(16) NULL,
+			sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+			backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+			backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+			name VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP NULL,
+			UNIQUE KEY uq_webauthn_credential_id (credential_id(255)),
+			INDEX idx_webauthn_credentials_user (user_id),
+			CONSTRAINT fk_webauthn_credentials_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NULL,
+			event VARCHAR(64) NOT NULL,
+			ip VARCHAR(45) NOT NULL DEFAULT '',
+			user_agent VARCHAR(255) NOT NULL DEFAULT '',
+			details TEXT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_audit_log_user (user_id, created_at),
+			INDEX idx_audit_log_event (event, created_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS password_history (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_password_history_user (user_id, id),
+			CONSTRAINT fk_password_history_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`,
+}
+
+type columnMigration struct {
+	table, column, definition string
+}
+
+// колонки, добавленные после первого релиза: CREATE TABLE IF NOT EXISTS
+// их в уже существующие таблицы не добавит
+var columnMigrations = []columnMigration{
+	{"users", "token_version", "INT NOT NULL DEFAULT 0"},
+	{"users", "role_id", "INT NOT NULL DEFAULT 1"},
+	{"users", "password_changed_at", "TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP"},
+}
+
+func RunMigrations(db *sql.DB) error {
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+	for _, m := range columnMigrations {
+		if err := addColumnIfNotExists(db, m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfNotExists нужен для таблиц, созданных до появления колонки:
+// MySQL 8.0 не поддерживает ADD COLUMN IF NOT EXISTS.
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`, table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect column %s.%s: %w", table, column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+)
+
+type mysqlAuditRepo struct {
+	db *sql.DB
+}
+
+func NewmysqlAuditRepo(db *sql.DB) AuditRepo {
+	return &mysqlAuditRepo{db: db}
+}
+
+type AuditRepo interface {
+	Record(ctx context.Context, event model.AuditEvent) error
+}
+
+func (r *mysqlAuditRepo) Record(ctx context.Context, event model.AuditEvent) error {
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		raw, err := json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		details = sql.NullString{String: string(raw), Valid: true}
+	}
+	var userID sql.NullInt64
+	if event.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(event.UserID), Valid: true}
+	}
+	query := `
+		INSERT INTO audit_log (user_id, event, ip, user_agent, details)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, event.Event, event.Client.IP, event.Client.UserAgent, details)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	return nil
+}
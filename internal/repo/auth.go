@@ -1,94 +1,325 @@
-package repo
-
-import (
-	"context"
-	"database/sql"
-	"fmt"
-	"friend-help/internal/errs"
-	"friend-help/internal/model"
-
-	_ "github.com/go-sql-driver/mysql"
-)
-
-type mysqlAuthRepo struct {
-	db *sql.DB
-}
-
-func NewmysqlAuthRepo(db *sql.DB) AuthRepo {
-	return &mysqlAuthRepo{db: db}
-}
-
-type AuthRepo interface {
-	CheckUserExists(ctx context.Context, login, email string) (bool, error)
-	CreateUser(ctx context.Context, user model.AuthUser) (int, error)
-	GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error)
-}
-
-func (r *mysqlAuthRepo) CheckUserExists(ctx context.Context, login, email string) (bool, error) {
-	var count int
-	var query string
-	var args []interface{}
-	if email == "" {
-		query = "SELECT COUNT(*) FROM users WHERE login = ?"
-		args = append(args, login)
-	} else {
-		query = "SELECT COUNT(*) FROM users WHERE login = ? OR email = ?"
-		args = append(args, login, email)
-	}
-	row := r.db.QueryRowContext(ctx, query, args...)
-	err := row.Scan(&count)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		return false, fmt.Errorf("failed to execute CheckUserExists query: %w", err)
-	}
-	return count > 0, nil
-}
-
-func (r *mysqlAuthRepo) CreateUser(ctx context.Context, user model.AuthUser) (int, error) {
-	query := `
-		INSERT INTO users (username, email, login, password_hash, is_activated)
-		VALUES (?, ?, ?, ?, ?)
-	`
-	result, err := r.db.ExecContext(
-		ctx,
-		query,
-		user.Username,
-		user.Email,
-		user.Login,
-		user.PasswordHash,
-		user.IsActivated,
-	)
-	if err != nil {
-		return 0, fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
-	}
-	lastID, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
-	}
-	return int(lastID), nil
-}
-
-func (r *mysqlAuthRepo) GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error) {
-	user := &model.AuthUser{}
-	query := `
-		SELECT id, login, email, password_hash, is_activated 
-		FROM users
-		WHERE login = ? OR email = ?
-	`
-	err := r.db.QueryRowContext(ctx, query, identifier, identifier).Scan(
-		&user.ID,
-		&user.Login,
-		&user.Email,
-		&user.PasswordHash,
-		&user.IsActivated,
-	)
-	if err == sql.ErrNoRows {
-		return nil, errs.ErrUserNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
-	}
-	return user, nil
-}
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type mysqlAuthRepo struct {
+	db *sql.DB
+}
+
+func NewmysqlAuthRepo(db *sql.DB) AuthRepo {
+	return &mysqlAuthRepo{db: db}
+}
+
+type AuthRepo interface {
+	CheckUserExists(ctx context.Context, login, email string) (bool, error)
+	CreateUser(ctx context.Context, user model.AuthUser) (int, error)
+	GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error)
+	GetUserByID(ctx context.Context, userID int) (*model.AuthUser, error)
+	GetTokenVersion(ctx context.Context, userID int) (int, error)
+	IncrementTokenVersion(ctx context.Context, userID int) (int, error)
+	SetUserRole(ctx context.Context, userID int, role int) error
+	ActivateUser(ctx context.Context, userID int) error
+	UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error
+	ChangePasswordHash(ctx context.Context, userID int, passwordHash string, keepHistory int) error
+	GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error)
+	GetRolePermissions(ctx context.Context, role int) ([]string, error)
+}
+
+func (r *mysqlAuthRepo) CheckUserExists(ctx context.Context, login, email string) (bool, error) {
+	var count int
+	var query string
+	var args []interface{}
+	if email == "" {
+		query = "SELECT COUNT(*) FROM users WHERE login = ?"
+		args = append(args, login)
+	} else {
+		query = "SELECT COUNT(*) FROM users WHERE login = ? OR email = ?"
+		args = append(args, login, email)
+	}
+	row := r.db.QueryRowContext(ctx, query, args...)
+	err := row.Scan(&count)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to execute CheckUserExists query: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *mysqlAuthRepo) CreateUser(ctx context.Context, user model.AuthUser) (int, error) {
+	query := `
+		INSERT INTO users (username, email, login, password_hash, is_activated, role_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if user.Role == 0 {
+		user.Role = model.Member
+	}
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		user.Username,
+		user.Email,
+		user.Login,
+		user.PasswordHash,
+		user.IsActivated,
+		user.Role,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return int(lastID), nil
+}
+
+func (r *mysqlAuthRepo) GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error) {
+	user := &model.AuthUser{}
+	query := `
+		SELECT id, login, email, password_hash, password_changed_at, is_activated, token_version, role_id
+		FROM users
+		WHERE login = ? OR email = ?
+	`
+	err := r.db.QueryRowContext(ctx, query, identifier, identifier).Scan(
+		&user.ID,
+		&user.Login,
+		&user.Email,
+		&user.PasswordHash,
+		&user.PasswordChangedAt,
+		&user.IsActivated,
+		&user.TokenVersion,
+		&user.Role,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errs.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return user, nil
+}
+
+func (r *mysqlAuthRepo) GetUserByID(ctx context.Context, userID int) (*model.AuthUser, error) {
+	user := &model.AuthUser{}
+	query := `
+		SELECT id, login, email, password_hash, password_changed_at, is_activated, token_version, role_id
+		FROM users
+		WHERE id = ?
+	`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Login,
+		&user.Email,
+		&user.PasswordHash,
+		&user.PasswordChangedAt,
+		&user.IsActivated,
+		&user.TokenVersion,
+		&user.Role,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errs.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return user, nil
+}
+
+func (r *mysqlAuthRepo) GetTokenVersion(ctx context.Context, userID int) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx, "SELECT token_version FROM users WHERE id = ?", userID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, errs.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute GetTokenVersion query: %w", err)
+	}
+	return version, nil
+}
+
+func (r *mysqlAuthRepo) IncrementTokenVersion(ctx context.Context, userID int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment token version: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, errs.ErrUserNotFound
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, "SELECT token_version FROM users WHERE id = ?", userID).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read token version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit token version: %w", err)
+	}
+	return version, nil
+}
+
+func (r *mysqlAuthRepo) SetUserRole(ctx context.Context, userID int, role int) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET role_id = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	if n == 0 {
+		var exists int
+		err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to set user role: %w", err)
+		}
+		if exists == 0 {
+			return errs.ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+func (r *mysqlAuthRepo) ActivateUser(ctx context.Context, userID int) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET is_activated = true WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to activate user: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to activate user: %w", err)
+	}
+	if n == 0 {
+		// 0 строк и для уже активированного пользователя — проверяем, что он существует
+		var exists int
+		err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to activate user: %w", err)
+		}
+		if exists == 0 {
+			return errs.ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// UpdatePasswordHash заменяет хеш того же пароля (пересчёт с новыми параметрами):
+// история паролей и password_changed_at не меняются.
+func (r *mysqlAuthRepo) UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	if n == 0 {
+		return errs.ErrUserNotFound
+	}
+	return nil
+}
+
+// ChangePasswordHash сохраняет новый пароль: прежний хеш уходит в password_history,
+// где остаются только keepHistory последних записей, а password_changed_at
+// сдвигается на текущее время.
+func (r *mysqlAuthRepo) ChangePasswordHash(ctx context.Context, userID int, passwordHash string, keepHistory int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to change password hash: %w", err)
+	}
+	defer tx.Rollback()
+	var previous string
+	err = tx.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = ? FOR UPDATE", userID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return errs.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change password hash: %w", err)
+	}
+	if keepHistory > 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO password_history (user_id, password_hash) VALUES (?, ?)", userID, previous); err != nil {
+			return fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+		}
+	}
+	// MySQL не разрешает LIMIT в подзапросе IN, поэтому он обёрнут в производную таблицу
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+			) AS recent
+		)
+	`, userID, userID, keepHistory)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET password_hash = ?, password_changed_at = CURRENT_TIMESTAMP WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to change password hash: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to change password hash: %w", err)
+	}
+	return nil
+}
+
+// GetPasswordHistory возвращает до limit прежних хешей пользователя, начиная с последнего.
+func (r *mysqlAuthRepo) GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?", userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GetPasswordHistory query: %w", err)
+	}
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate password history: %w", err)
+	}
+	return hashes, nil
+}
+
+func (r *mysqlAuthRepo) GetRolePermissions(ctx context.Context, role int) ([]string, error) {
+	query := `
+		SELECT p.name
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = ?
+		ORDER BY p.name
+	`
+	rows, err := r.db.QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GetRolePermissions query: %w", err)
+	}
+	defer rows.Close()
+	var permissions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate permissions: %w", err)
+	}
+	return permissions, nil
+}
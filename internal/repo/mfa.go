@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"time"
+)
+
+type mysqlMFARepo struct {
+	db *sql.DB
+}
+
+func NewmysqlMFARepo(db *sql.DB) MFARepo {
+	return &mysqlMFARepo{db: db}
+}
+
+type MFARepo interface {
+	SaveTOTP(ctx context.Context, userID int, secretEnc []byte) error
+	GetTOTP(ctx context.Context, userID int) (*model.TOTPSecret, error)
+	ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	ListUnusedRecoveryCodes(ctx context.Context, userID int) ([]model.RecoveryCode, error)
+	UseRecoveryCode(ctx context.Context, codeID int) (bool, error)
+	EnsureWebAuthnHandle(ctx context.Context, userID int, candidate []byte) ([]byte, error)
+	GetUserIDByWebAuthnHandle(ctx context.Context, handle []byte) (int, error)
+	AddWebAuthnCredential(ctx context.Context, credential model.WebAuthnCredential) (int, error)
+	ListWebAuthnCredentials(ctx context.Context, userID int) ([]model.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error
+	DeleteWebAuthnCredential(ctx context.Context, userID, id int) error
+}
+
+// SaveTOTP сохраняет новый неподтверждённый секрет, заменяя прежний неподтверждённый.
+// Подтверждённый секрет не перезаписывается.
+func (r *mysqlMFARepo) SaveTOTP(ctx context.Context, userID int, secretEnc []byte) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret_enc) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE
+			secret_enc = IF(confirmed_at IS NULL, VALUES(secret_enc), secret_enc),
+			created_at = IF(confirmed_at IS NULL, CURRENT_TIMESTAMP, created_at)
+	`
+	if _, err := r.db.ExecContext(ctx, query, userID, secretEnc); err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	return nil
+}
+
+func (r *mysqlMFARepo) GetTOTP(ctx context.Context, userID int) (*model.TOTPSecret, error) {
+	secret := &model.TOTPSecret{UserID: userID}
+	query := `SELECT secret_enc, confirmed_at, last_step FROM user_totp WHERE user_id = ?`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&secret.SecretEnc, &secret.ConfirmedAt, &secret.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, errs.ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GetTOTP query: %w", err)
+	}
+	return secret, nil
+}
+
+// ConfirmTOTP включает TOTP и в той же транзакции заменяет коды восстановления:
+// второй фактор не должен включиться без кодов, которые видел пользователь.
+func (r *mysqlMFARepo) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+	defer tx.Rollback()
+	query := `UPDATE user_totp SET confirmed_at = ?, last_step = ? WHERE user_id = ? AND confirmed_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, time.Now(), step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+	if n == 0 {
+		return errs.ErrTOTPNotEnabled
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep атомарно запоминает шаг принятого кода. false означает, что код
+// этого или более позднего шага уже был использован.
+func (r *mysqlMFARepo) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`
+	result, err := r.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP step: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP step: %w", err)
+	}
+	return n == 1, nil
+}
+
+// DeleteTOTP отключает TOTP. Коды восстановления удаляются, только если
+// у пользователя не осталось passkey: они относятся ко второму фактору целиком.
+func (r *mysqlMFARepo) DeleteTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM mfa_recovery_codes
+		WHERE user_id = ? AND NOT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = ?)
+	`, userID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя новым набором.
+func (r *mysqlMFARepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	defer tx.Rollback()
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+		}
+	}
+	return nil
+}
+
+func (r *mysqlMFARepo) ListUnusedRecoveryCodes(ctx context.Context, userID int) ([]model.RecoveryCode, error) {
+	query := `SELECT id, code_hash FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute ListUnusedRecoveryCodes query: %w", err)
+	}
+	defer rows.Close()
+	var codes []model.RecoveryCode
+	for rows.Next() {
+		code := model.RecoveryCode{UserID: userID}
+		if err := rows.Scan(&code.ID, &code.CodeHash); err != nil {
+			return nil, fmt.Errorf("failed to scan recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode помечает код использованным; false — код уже был использован.
+func (r *mysqlMFARepo) UseRecoveryCode(ctx context.Context, codeID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE mfa_recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), codeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"time"
+)
+
+type mysqlSessionRepo struct {
+	db *sql.DB
+}
+
+func NewmysqlSessionRepo(db *sql.DB) SessionRepo {
+	return &mysqlSessionRepo{db: db}
+}
+
+type SessionRepo interface {
+	CreateSession(ctx context.Context, session model.Session) error
+	GetSession(ctx context.Context, sessionID string) (*model.Session, error)
+	ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error)
+	TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error
+	ExtendSession(ctx context.Context, sessionID string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) ([]string, error)
+}
+
+func (r *mysqlSessionRepo) CreateSession(ctx context.Context, session model.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	return nil
+}
+
+func (r *mysqlSessionRepo) GetSession(ctx context.Context, sessionID string) (*model.Session, error) {
+	session := &model.Session{}
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions
+		WHERE id = ?
+	`
+	err := r.db.QueryRowContext(ctx, query, sessionID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errs.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return session, nil
+}
+
+func (r *mysqlSessionRepo) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute ListActiveSessions query: %w", err)
+	}
+	defer rows.Close()
+	sessions := []model.Session{}
+	for rows.Next() {
+		var session model.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *mysqlSessionRepo) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", seenAt, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+func (r *mysqlSessionRepo) ExtendSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET expires_at = ?, last_seen_at = NOW() WHERE id = ?", expiresAt, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	return nil
+}
+
+func (r *mysqlSessionRepo) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL", sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions помечает отозванными все активные сессии пользователя,
+// кроме exceptSessionID, и возвращает их ID.
+func (r *mysqlSessionRepo) RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM sessions
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, userID, exceptSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select sessions: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL
+	`, userID, exceptSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit session revocation: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const mysqlErrDuplicateEntry = 1062
+
+// EnsureWebAuthnHandle возвращает user handle пользователя для WebAuthn,
+// при первом обращении сохраняя candidate. Handle случаен и не раскрывает ID.
+func (r *mysqlMFARepo) EnsureWebAuthnHandle(ctx context.Context, userID int, candidate []byte) ([]byte, error) {
+	_, err := r.db.ExecContext(ctx, "INSERT IGNORE INTO webauthn_user_handles (user_id, handle) VALUES (?, ?)", userID, candidate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	var handle []byte
+	err = r.db.QueryRowContext(ctx, "SELECT handle FROM webauthn_user_handles WHERE user_id = ?", userID).Scan(&handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute EnsureWebAuthnHandle query: %w", err)
+	}
+	return handle, nil
+}
+
+func (r *mysqlMFARepo) GetUserIDByWebAuthnHandle(ctx context.Context, handle []byte) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, "SELECT user_id FROM webauthn_user_handles WHERE handle = ?", handle).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, errs.ErrWebAuthnCredentialNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute GetUserIDByWebAuthnHandle query: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *mysqlMFARepo) AddWebAuthnCredential(ctx context.Context, c model.WebAuthnCredential) (int, error) {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type,
+			transports, aaguid, sign_count, backup_eligible, backup_state, name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.ExecContext(ctx, query, c.UserID, c.CredentialID, c.PublicKey, c.AttestationType,
+		strings.Join(c.Transports, ","), c.AAGUID, c.SignCount, c.BackupEligible, c.BackupState, c.Name)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+			return 0, errs.ErrWebAuthnCredentialExists
+		}
+		return 0, fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errs.ErrDBInsertFailed, err)
+	}
+	return int(id), nil
+}
+
+func (r *mysqlMFARepo) ListWebAuthnCredentials(ctx context.Context, userID int) ([]model.WebAuthnCredential, error) {
+	query := `
+		SELECT id, credential_id, public_key, attestation_type, transports, aaguid, sign_count,
+			backup_eligible, backup_state, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_id = ? ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute ListWebAuthnCredentials query: %w", err)
+	}
+	defer rows.Close()
+	var credentials []model.WebAuthnCredential
+	for rows.Next() {
+		c := model.WebAuthnCredential{UserID: userID}
+		var transports string
+		err := rows.Scan(&c.ID, &c.CredentialID, &c.PublicKey, &c.AttestationType, &transports, &c.AAGUID,
+			&c.SignCount, &c.BackupEligible, &c.BackupState, &c.Name, &c.CreatedAt, &c.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webauthn credential: %w", err)
+		}
+		if transports != "" {
+			c.Transports = strings.Split(transports, ",")
+		}
+		credentials = append(credentials, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webauthn credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredentialUsage сохраняет счётчик подписей после успешной проверки.
+func (r *mysqlMFARepo) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	query := `UPDATE webauthn_credentials SET sign_count = ?, backup_state = ?, last_used_at = ? WHERE credential_id = ?`
+	if _, err := r.db.ExecContext(ctx, query, signCount, backupState, time.Now(), credentialID); err != nil {
+		return fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential удаляет passkey, а вместе с последним вторым
+// фактором — и коды восстановления, как DeleteTOTP.
+func (r *mysqlMFARepo) DeleteWebAuthnCredential(ctx context.Context, userID, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	if n == 0 {
+		return errs.ErrWebAuthnCredentialNotFound
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM mfa_recovery_codes
+		WHERE user_id = ?
+			AND NOT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM user_totp WHERE user_id = ? AND confirmed_at IS NOT NULL)
+	`, userID, userID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	return nil
+}
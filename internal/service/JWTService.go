@@ -1,71 +1,260 @@
-package service
-
-import (
-	"errors"
-	"fmt"
-	"friend-help/internal/errs"
-	"friend-help/internal/model"
-	"os"
-	"strconv"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-type JwtService struct {
-	tokenTTL  time.Duration
-	secretKey string
-}
-
-func NewJwtService() (*JwtService, error) {
-	tokenTTLs := os.Getenv("TOKEN_TTL_HOURS")
-	if tokenTTLs == "" {
-		return nil, errors.New("var TOKEN_TTL_HOURS not found")
-	}
-	tokenTTLi, err := strconv.Atoi(tokenTTLs)
-	if err != nil {
-		return nil, fmt.Errorf("var TOKEN_TTL_HOURS bad format: %w", err)
-	}
-	JWTSecretKey := os.Getenv("JWT_SECRET_KEY")
-	if JWTSecretKey == "" {
-		return nil, errors.New("var JWT_SECRET_KEY not found")
-	}
-	return &JwtService{
-		tokenTTL:  time.Duration(tokenTTLi) * time.Hour,
-		secretKey: JWTSecretKey,
-	}, nil
-}
-
-func (j *JwtService) GenToken(userID int, role int) (string, error) {
-	claims := model.AuthClaims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.tokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(j.secretKey))
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
-}
-
-func (j *JwtService) ParseTokenAndGetClaims(tokenString string) (*model.AuthClaims, error) {
-	claims := &model.AuthClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errs.ErrUnexpectedSigningMethod
-		}
-		return []byte(j.secretKey), nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	if !token.Valid {
-		return nil, errs.ErrInvalidToken
-	}
-	return claims, nil
-}
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JwtService struct {
+	tokenTTL   time.Duration
+	refreshTTL time.Duration
+	keys       *keyRing
+	issuer     string
+	audience   []string
+	leeway     time.Duration
+}
+
+const (
+	defaultAccessTTLMinutes = 15
+	defaultRefreshTTLHours  = 720
+	defaultLeewaySeconds    = 30
+)
+
+func NewJwtService() (*JwtService, error) {
+	tokenTTL, err := loadAccessTTL()
+	if err != nil {
+		return nil, err
+	}
+	refreshTTLi := defaultRefreshTTLHours
+	if refreshTTLs := os.Getenv("REFRESH_TOKEN_TTL_HOURS"); refreshTTLs != "" {
+		refreshTTLi, err = strconv.Atoi(refreshTTLs)
+		if err != nil || refreshTTLi <= 0 {
+			return nil, fmt.Errorf("var REFRESH_TOKEN_TTL_HOURS bad format: %q", refreshTTLs)
+		}
+	}
+	leewayi := defaultLeewaySeconds
+	if leeways := os.Getenv("JWT_LEEWAY_SECONDS"); leeways != "" {
+		leewayi, err = strconv.Atoi(leeways)
+		if err != nil || leewayi < 0 {
+			return nil, fmt.Errorf("var JWT_LEEWAY_SECONDS bad format: %q", leeways)
+		}
+	}
+	keys, err := newKeyRingFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &JwtService{
+		tokenTTL:   tokenTTL,
+		refreshTTL: time.Duration(refreshTTLi) * time.Hour,
+		keys:       keys,
+		issuer:     strings.TrimRight(os.Getenv("JWT_ISSUER"), "/"),
+		audience:   splitList(os.Getenv("JWT_AUDIENCE")),
+		leeway:     time.Duration(leewayi) * time.Second,
+	}, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTokenID генерирует jti в формате UUIDv4.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// loadAccessTTL читает ACCESS_TOKEN_TTL_MINUTES. Устаревший TOKEN_TTL_HOURS
+// больше не учитывается: в старых конфигах он задавал срок в сотню часов, а
+// access-токены теперь короткоживущие и продлеваются через refresh-токен.
+func loadAccessTTL() (time.Duration, error) {
+	if os.Getenv("TOKEN_TTL_HOURS") != "" {
+		slog.Warn("var TOKEN_TTL_HOURS is deprecated and ignored, use ACCESS_TOKEN_TTL_MINUTES")
+	}
+	if accessTTLs := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); accessTTLs != "" {
+		accessTTLi, err := strconv.Atoi(accessTTLs)
+		if err != nil || accessTTLi <= 0 {
+			return 0, fmt.Errorf("var ACCESS_TOKEN_TTL_MINUTES bad format: %q", accessTTLs)
+		}
+		return time.Duration(accessTTLi) * time.Minute, nil
+	}
+	return defaultAccessTTLMinutes * time.Minute, nil
+}
+
+// Algorithm — алгоритм подписывающего ключа; пусто, если ключ выведен из оборота.
+func (j *JwtService) Algorithm() string {
+	key, err := j.keys.signing()
+	if err != nil {
+		return ""
+	}
+	return key.method.Alg()
+}
+
+// Issuer — публичный базовый URL сервиса (JWT_ISSUER), может быть пустым.
+func (j *JwtService) Issuer() string {
+	return j.issuer
+}
+
+// JWKS публикует публичные части всех действующих асимметричных ключей.
+func (j *JwtService) JWKS() model.JWKSet {
+	set := model.JWKSet{Keys: []model.JWK{}}
+	for _, key := range j.keys.active() {
+		if jwk, ok := publicJWK(key.id, key.signingKey); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Algorithms возвращает алгоритмы действующих ключей без повторов.
+func (j *JwtService) Algorithms() []string {
+	var algs []string
+	seen := map[string]bool{}
+	for _, key := range j.keys.active() {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+func (j *JwtService) SigningKeyID() string {
+	key, err := j.keys.signing()
+	if err != nil {
+		return ""
+	}
+	return key.id
+}
+
+// ReloadKeys перечитывает JWT_KEYS_FILE.
+func (j *JwtService) ReloadKeys() error {
+	if j.keys.manifestPath == "" {
+		return nil
+	}
+	return j.keys.reload()
+}
+
+// WatchKeys отслеживает изменения JWT_KEYS_FILE и подхватывает новые ключи.
+func (j *JwtService) WatchKeys(ctx context.Context) error {
+	interval, err := keysReloadInterval()
+	if err != nil {
+		return err
+	}
+	go j.keys.watch(ctx, interval)
+	return nil
+}
+
+func (j *JwtService) AccessTTL() time.Duration {
+	return j.tokenTTL
+}
+
+func (j *JwtService) RefreshTTL() time.Duration {
+	return j.refreshTTL
+}
+
+func (j *JwtService) GenToken(subject model.TokenSubject) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := model.AuthClaims{
+		UserID:       subject.UserID,
+		Role:         subject.Role,
+		TokenVersion: subject.TokenVersion,
+		SessionID:    subject.SessionID,
+		Scope:        strings.Join(subject.Permissions, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   strconv.Itoa(subject.UserID),
+			Audience:  j.audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.tokenTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	key, err := j.keys.signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+func (j *JwtService) ParseTokenAndGetClaims(tokenString string) (*model.AuthClaims, error) {
+	claims := &model.AuthClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, j.keyFunc(model.AccessTokenType), j.parserOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errs.ErrInvalidToken
+	}
+	if claims.Subject != "" && claims.Subject != strconv.Itoa(claims.UserID) {
+		return nil, errs.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// keyFunc выбирает ключ по kid и пропускает только токены типа typ,
+// чтобы одноразовые токены действий нельзя было предъявить как access-токен.
+// Access-токены без заголовка typ тоже принимаются.
+func (j *JwtService) keyFunc(typ string) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		header, _ := token.Header["typ"].(string)
+		if header != typ && !(header == "" && typ == model.AccessTokenType) {
+			return nil, errs.ErrInvalidToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := j.keys.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errs.ErrUnexpectedSigningMethod
+		}
+		return key.public, nil
+	}
+}
+
+func (j *JwtService) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(j.leeway),
+	}
+	if j.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.issuer))
+	}
+	if len(j.audience) > 0 {
+		opts = append(opts, jwt.WithAudience(j.audience...))
+	}
+	return opts
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Токены действий подписываются тем же ключом, что и access-токены, но имеют
+// typ action+jwt и claim purpose. Одноразовость обеспечивает ключ
+// action_token:<jti> в Redis, который удаляется при использовании.
+const (
+	actionTokenKeyPrefix = "action_token:"
+
+	PurposeVerifyEmail    = "verify_email"
+	PurposeMFA            = "mfa_pending"
+	PurposePasswordChange = "password_change"
+)
+
+func (j *JwtService) GenActionToken(purpose string, userID, tokenVersion int, ttl time.Duration) (string, *model.ActionClaims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims := &model.ActionClaims{
+		UserID:       userID,
+		Purpose:      purpose,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   strconv.Itoa(userID),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	key, err := j.keys.signing()
+	if err != nil {
+		return "", nil, err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["typ"] = model.ActionTokenType
+	token.Header["kid"] = key.id
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+func (j *JwtService) ParseActionToken(tokenString, purpose string) (*model.ActionClaims, error) {
+	claims := &model.ActionClaims{}
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(j.leeway)}
+	if j.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.issuer))
+	}
+	token, err := jwt.ParseWithClaims(tokenString, claims, j.keyFunc(model.ActionTokenType), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != purpose || claims.ID == "" {
+		return nil, errs.ErrInvalidToken
+	}
+	if claims.Subject != strconv.Itoa(claims.UserID) {
+		return nil, errs.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *AuthService) issueActionToken(ctx context.Context, purpose string, user *model.AuthUser, ttl time.Duration) (string, error) {
+	token, claims, err := s.jwtService.GenActionToken(purpose, user.ID, user.TokenVersion, ttl)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedGenToken, err)
+	}
+	if err := s.redisService.Set(ctx, actionTokenKeyPrefix+claims.ID, user.ID, ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store action token in Redis: %w", err)
+	}
+	return token, nil
+}
+
+// consumeActionToken проверяет токен и гасит его; второй вызов с тем же
+// токеном вернёт ErrInvalidActionToken.
+func (s *AuthService) consumeActionToken(ctx context.Context, tokenString, purpose string) (*model.ActionClaims, error) {
+	claims, err := s.jwtService.ParseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidActionToken, err)
+	}
+	if err := s.burnActionToken(ctx, claims.ID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// peekActionToken проверяет токен, не гася его.
+func (s *AuthService) peekActionToken(ctx context.Context, tokenString, purpose string) (*model.ActionClaims, error) {
+	claims, err := s.jwtService.ParseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidActionToken, err)
+	}
+	n, err := s.redisService.Exists(ctx, actionTokenKeyPrefix+claims.ID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check action token in Redis: %w", err)
+	}
+	if n == 0 {
+		return nil, errs.ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+func (s *AuthService) burnActionToken(ctx context.Context, jti string) error {
+	n, err := s.redisService.Del(ctx, actionTokenKeyPrefix+jti).Result()
+	if err != nil {
+		return fmt.Errorf("failed to consume action token in Redis: %w", err)
+	}
+	if n == 0 {
+		return errs.ErrInvalidActionToken
+	}
+	return nil
+}
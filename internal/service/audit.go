@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"friend-help/internal/model"
+	"log/slog"
+)
+
+// audit пишет событие в журнал аудита. Сбой записи не прерывает операцию,
+// но попадает в лог.
+func (s *AuthService) audit(ctx context.Context, event model.AuditEvent) {
+	event.Client.UserAgent = truncateRunes(event.Client.UserAgent, maxUserAgentLen)
+	if err := s.auditRepo.Record(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to write audit event", "event", event.Event, "user_id", event.UserID, "error", err)
+	}
+}
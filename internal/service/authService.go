@@ -1,127 +1,320 @@
-package service
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"friend-help/internal/cache"
-	"friend-help/internal/errs"
-	"friend-help/internal/model"
-	"friend-help/internal/repo"
-	"regexp"
-	"time"
-
-	"github.com/go-redis/redis/v8"
-	"golang.org/x/crypto/bcrypt"
-)
-
-type AuthService struct {
-	authRepo     repo.AuthRepo
-	jwtService   *JwtService
-	redisService *cache.RedisService
-}
-
-func NewAuthService(authRepo repo.AuthRepo, JwtService *JwtService, redisService *cache.RedisService) *AuthService {
-	return &AuthService{
-		authRepo:     authRepo,
-		jwtService:   JwtService,
-		redisService: redisService,
-	}
-}
-
-var loginRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
-
-func ValidateLoginChars(login string) error {
-	if !loginRegex.MatchString(login) {
-		return fmt.Errorf("%w: Login '%s' must contain only en letters, numbers, underscore", errs.ErrInvalidLoginChars, login)
-	}
-	return nil
-}
-
-func (s *AuthService) RegNewUser(ctx context.Context, req model.AuthRegReq) (int, string, error) {
-	if err := ValidateLoginChars(req.Login); err != nil {
-		return 0, "", err
-	}
-	b, err := s.authRepo.CheckUserExists(ctx, req.Login, req.Email)
-	if err != nil {
-		return 0, "", err
-	}
-	if b {
-		return 0, "", errs.ErrUserExists
-	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return 0, "", fmt.Errorf("%w: %w", errs.ErrFailedHashPass, err)
-	}
-	newUser := model.AuthUser{
-		Login:        req.Login,
-		Email:        &req.Email,
-		Username:     req.Login,
-		PasswordHash: string(hashedPassword),
-		IsActivated:  true,
-	}
-	userID, err := s.authRepo.CreateUser(ctx, newUser)
-	if err != nil {
-		return 0, "", fmt.Errorf("%w: %w", errs.ErrFailedToAddUserInDB, err)
-	}
-	token, err := s.jwtService.GenToken(userID, model.Member)
-	if err != nil {
-		return 0, "", fmt.Errorf("%w: %w", errs.ErrFailedGenToken, err)
-	}
-	return userID, token, nil
-}
-
-func (s *AuthService) Authenticate(ctx context.Context, identifier string, password string) (*model.AuthUser, string, error) {
-	user, err := s.authRepo.GetUserByLoginOrEmail(ctx, identifier)
-	if err != nil {
-		return nil, "", err
-	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return nil, "", errs.ErrInvalidLoginOrPass
-		}
-		return nil, "", fmt.Errorf("%w: %w", errs.ErrFailedToComparePassHash, err)
-	}
-	token, err := s.jwtService.GenToken(user.ID, model.Member)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
-	}
-	return user, token, nil
-}
-
-func (s *AuthService) Logout(ctx context.Context, tokenString string) error {
-	claims, err := s.jwtService.ParseTokenAndGetClaims(tokenString)
-	if err != nil {
-		return nil
-	}
-	if claims.ExpiresAt == nil {
-		return errs.ErrInvalidTokenExpTime
-	}
-	timeUntilExpiry := time.Until(claims.ExpiresAt.Time)
-	if timeUntilExpiry <= 0 {
-		return nil
-	}
-	key := fmt.Sprintf("blacklist:%s", tokenString)
-	cmd := s.redisService.Set(ctx, key, claims.UserID, timeUntilExpiry)
-	if cmd.Err() != nil {
-		return fmt.Errorf("failed to blacklist token in Redis: %w", cmd.Err())
-	}
-	return nil
-}
-
-func (s *AuthService) IsTokenBlacklisted(ctx context.Context, tokenString string) (bool, error) {
-	key := fmt.Sprintf("blacklist:%s", tokenString)
-	cmd := s.redisService.Get(ctx, key)
-	if cmd.Err() == redis.Nil {
-		return false, nil
-	}
-	if cmd.Err() != nil {
-		return false, fmt.Errorf("failed to check blacklist in Redis: %w", cmd.Err())
-	}
-	return true, nil
-}
-
-func (s *AuthService) ParseTokenAndGetClaims(tokenString string) (*model.AuthClaims, error) {
-	return s.jwtService.ParseTokenAndGetClaims(tokenString)
-}
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/cache"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"friend-help/internal/model"
+	"friend-help/internal/passhash"
+	"friend-help/internal/passpolicy"
+	"friend-help/internal/repo"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type AuthService struct {
+	authRepo          repo.AuthRepo
+	sessionRepo       repo.SessionRepo
+	mfaRepo           repo.MFARepo
+	auditRepo         repo.AuditRepo
+	jwtService        *JwtService
+	redisService      *cache.RedisService
+	mailer            mail.Mailer
+	hasher            passhash.PasswordHasher
+	passwordPolicy    *passpolicy.Policy
+	secretBox         *secretBox
+	webAuthn          *webauthn.WebAuthn
+	mfaIssuer         string
+	emailVerification emailVerificationConfig
+	passwordReset     passwordResetConfig
+	loginThrottle     loginThrottleConfig
+	passwordLifetime  passwordLifetimeConfig
+
+	enumerationSafeRegistration bool
+	dummyPasswordHash           string
+}
+
+func NewAuthService(authRepo repo.AuthRepo, sessionRepo repo.SessionRepo, mfaRepo repo.MFARepo, auditRepo repo.AuditRepo, JwtService *JwtService, redisService *cache.RedisService, mailer mail.Mailer) (*AuthService, error) {
+	emailVerification, err := loadEmailVerificationConfig(JwtService.Issuer())
+	if err != nil {
+		return nil, err
+	}
+	passwordReset, err := loadPasswordResetConfig(JwtService.Issuer())
+	if err != nil {
+		return nil, err
+	}
+	box, err := newSecretBoxFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	loginThrottle, err := loadLoginThrottleConfig()
+	if err != nil {
+		return nil, err
+	}
+	passwordLifetime, err := loadPasswordLifetimeConfig()
+	if err != nil {
+		return nil, err
+	}
+	enumerationSafe, err := loadEnumerationSafeRegistration(emailVerification)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := passhash.NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicy, err := passpolicy.LoadFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	// иначе длинный пароль в режиме bcrypt дошёл бы до Hash и дал 500
+	passwordPolicy.MaxBytes = hasher.MaxPasswordBytes()
+	dummyHash, err := newDummyPasswordHash(hasher)
+	if err != nil {
+		return nil, err
+	}
+	mfaIssuer := mfaIssuerFromEnv()
+	webAuthn, err := newWebAuthnFromEnv(mfaIssuer)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthService{
+		authRepo:          authRepo,
+		sessionRepo:       sessionRepo,
+		mfaRepo:           mfaRepo,
+		auditRepo:         auditRepo,
+		jwtService:        JwtService,
+		redisService:      redisService,
+		mailer:            mailer,
+		hasher:            hasher,
+		passwordPolicy:    passwordPolicy,
+		secretBox:         box,
+		webAuthn:          webAuthn,
+		mfaIssuer:         mfaIssuer,
+		emailVerification: emailVerification,
+		passwordReset:     passwordReset,
+		loginThrottle:     loginThrottle,
+		passwordLifetime:  passwordLifetime,
+
+		enumerationSafeRegistration: enumerationSafe,
+		dummyPasswordHash:           dummyHash,
+	}, nil
+}
+
+var loginRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+func ValidateLoginChars(login string) error {
+	if !loginRegex.MatchString(login) {
+		return fmt.Errorf("%w: Login '%s' must contain only en letters, numbers, underscore", errs.ErrInvalidLoginChars, login)
+	}
+	return nil
+}
+
+// RegNewUser создаёт пользователя и сразу выдаёт токены. Если включено
+// подтверждение email, пользователь создаётся неактивным, получает письмо
+// со ссылкой, а токены не выдаются (возвращается nil).
+// В режиме REGISTRATION_ENUMERATION_SAFE занятые логин или email не дают
+// ErrUserExists: владелец адреса получает письмо, а вызывающий — тот же
+// результат, что и при успешной регистрации (0, nil, nil).
+func (s *AuthService) RegNewUser(ctx context.Context, req model.AuthRegReq, client model.ClientInfo) (int, *model.TokenPair, error) {
+	if err := ValidateLoginChars(req.Login); err != nil {
+		return 0, nil, err
+	}
+	if s.emailVerification.required && req.Email == "" {
+		return 0, nil, errs.ErrEmailRequired
+	}
+	if err := s.passwordPolicy.Check(req.Password, req.Login, req.Email); err != nil {
+		return 0, nil, err
+	}
+	// хешируем до проверки занятости, чтобы время ответа не зависело от неё
+	hashedPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", errs.ErrFailedHashPass, err)
+	}
+	b, err := s.authRepo.CheckUserExists(ctx, req.Login, req.Email)
+	if err != nil {
+		return 0, nil, err
+	}
+	if b {
+		if !s.enumerationSafeRegistration {
+			return 0, nil, errs.ErrUserExists
+		}
+		if err := s.notifyRegistrationConflict(ctx, req, client.Language); err != nil {
+			slog.ErrorContext(ctx, "failed to send registration conflict notice", "error", err)
+		}
+		return 0, nil, nil
+	}
+	newUser := model.AuthUser{
+		Login:        req.Login,
+		Email:        &req.Email,
+		Username:     req.Login,
+		PasswordHash: hashedPassword,
+		IsActivated:  !s.emailVerification.required,
+		Role:         model.Member,
+	}
+	userID, err := s.authRepo.CreateUser(ctx, newUser)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", errs.ErrFailedToAddUserInDB, err)
+	}
+	newUser.ID = userID
+	if !newUser.IsActivated {
+		// пользователь уже создан: при сбое отправки письмо можно запросить повторно
+		if err := s.sendVerificationEmail(ctx, &newUser, client.Language); err != nil {
+			slog.ErrorContext(ctx, "failed to send verification email", "user_id", userID, "error", err)
+		}
+		if s.enumerationSafeRegistration {
+			return 0, nil, nil
+		}
+		return userID, nil, nil
+	}
+	subject, err := s.tokenSubject(ctx, &newUser)
+	if err != nil {
+		return 0, nil, err
+	}
+	tokens, err := s.startSession(ctx, subject, client)
+	if err != nil {
+		return 0, nil, err
+	}
+	return userID, tokens, nil
+}
+
+// Authenticate проверяет пароль. Если у пользователя подключён второй фактор,
+// вместо токенов возвращается MFAToken для /api/auth/mfa/verify.
+// Неудачные попытки считаются по учётной записи и по IP; при блокировке
+// возвращается errs.RetryAfterError. Хеш, сделанный устаревшим алгоритмом
+// или с прежними параметрами, после успешной проверки пересчитывается.
+// Если пароль истёк (PASSWORD_MAX_AGE_DAYS), вместо токенов возвращается
+// PasswordChangeToken — с ним доступна только смена пароля.
+func (s *AuthService) Authenticate(ctx context.Context, identifier string, password string, client model.ClientInfo) (*model.LoginResult, error) {
+	if client.IP != "" {
+		if err := s.checkLoginLock(ctx, loginScopeIP+client.IP, errs.ErrTooManyAttempts); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.authRepo.GetUserByLoginOrEmail(ctx, identifier)
+	if err != nil && !errors.Is(err, errs.ErrUserNotFound) {
+		return nil, err
+	}
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+	accountKey := loginAccountKey(userID, identifier)
+	if err := s.checkLoginLock(ctx, accountKey, errs.ErrAccountLocked); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		s.burnPasswordCheck(password)
+		if err := s.recordLoginFailures(ctx, accountKey, client.IP); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrUserNotFound
+	}
+	ok, err := s.hasher.Verify(user.PasswordHash, password)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedToComparePassHash, err)
+	}
+	if !ok {
+		if err := s.recordLoginFailures(ctx, accountKey, client.IP); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrInvalidLoginOrPass
+	}
+	// счётчик неудач сбрасывает только завершённый вход (finishPasswordLogin):
+	// иначе верный пароль обнулял бы перебор кодов второго фактора
+	s.upgradePasswordHash(ctx, user, password)
+	if !user.IsActivated {
+		return nil, errs.ErrUserNotActivated
+	}
+	methods, err := s.mfaMethods(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		return s.startMFA(ctx, user, methods)
+	}
+	return s.finishPasswordLogin(ctx, user, client)
+}
+
+// tokenSubject собирает данные для access-токена, включая права роли пользователя.
+func (s *AuthService) tokenSubject(ctx context.Context, user *model.AuthUser) (model.TokenSubject, error) {
+	permissions, err := s.authRepo.GetRolePermissions(ctx, user.Role)
+	if err != nil {
+		return model.TokenSubject{}, err
+	}
+	return model.TokenSubject{
+		UserID:       user.ID,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Permissions:  permissions,
+	}, nil
+}
+
+func (s *AuthService) Logout(ctx context.Context, tokenString string) error {
+	claims, err := s.jwtService.ParseTokenAndGetClaims(tokenString)
+	if err != nil {
+		return nil
+	}
+	if claims.ExpiresAt == nil {
+		return errs.ErrInvalidTokenExpTime
+	}
+	timeUntilExpiry := time.Until(claims.ExpiresAt.Time)
+	if timeUntilExpiry <= 0 {
+		return nil
+	}
+	key := blacklistKey(claims.ID, tokenString)
+	cmd := s.redisService.Set(ctx, key, claims.UserID, timeUntilExpiry)
+	if cmd.Err() != nil {
+		return fmt.Errorf("failed to blacklist token in Redis: %w", cmd.Err())
+	}
+	if claims.SessionID != "" {
+		return s.revokeSession(ctx, claims.SessionID)
+	}
+	return nil
+}
+
+// IsTokenBlacklisted проверяет отзыв по jti (или sha256 для токенов без jti),
+// по sid сессии, а также по ключу старого формата blacklist:<токен>.
+func (s *AuthService) IsTokenBlacklisted(ctx context.Context, claims *model.AuthClaims, tokenString string) (bool, error) {
+	keys := []string{blacklistKey(claims.ID, tokenString), legacyBlacklistKey(tokenString)}
+	if claims.SessionID != "" {
+		keys = append(keys, blacklistSIDPrefix+claims.SessionID)
+	}
+	n, err := s.redisService.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check blacklist in Redis: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *AuthService) ParseTokenAndGetClaims(tokenString string) (*model.AuthClaims, error) {
+	return s.jwtService.ParseTokenAndGetClaims(tokenString)
+}
+
+func (s *AuthService) JWKS() model.JWKSet {
+	return s.jwtService.JWKS()
+}
+
+func (s *AuthService) Issuer() string {
+	return s.jwtService.Issuer()
+}
+
+func (s *AuthService) SigningAlgorithms() []string {
+	return s.jwtService.Algorithms()
+}
+
+// SetUserRole меняет роль пользователя. В токенах новая роль появится
+// при ближайшем обновлении или входе.
+func (s *AuthService) SetUserRole(ctx context.Context, userID int, roleName string) error {
+	role, ok := model.RoleByName(roleName)
+	if !ok {
+		return errs.ErrUnknownRole
+	}
+	return s.authRepo.SetUserRole(ctx, userID, role)
+}
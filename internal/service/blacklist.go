@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"friend-help/internal/model"
+	"log/slog"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Ключи чёрного списка:
+// blacklist:jti:<jti>        — токены с claim jti
+// blacklist:sha256:<hex>     — старые токены без jti
+// blacklist:sid:<sid>        — все токены отозванной сессии
+// blacklist:<токен целиком>  — устаревший формат, переносится MigrateLegacyBlacklist
+const (
+	blacklistPrefix       = "blacklist:"
+	blacklistJTIPrefix    = blacklistPrefix + "jti:"
+	blacklistSHA256Prefix = blacklistPrefix + "sha256:"
+	blacklistSIDPrefix    = blacklistPrefix + "sid:"
+)
+
+func blacklistKey(jti, tokenString string) string {
+	if jti != "" {
+		return blacklistJTIPrefix + jti
+	}
+	sum := sha256.Sum256([]byte(tokenString))
+	return blacklistSHA256Prefix + hex.EncodeToString(sum[:])
+}
+
+func legacyBlacklistKey(tokenString string) string {
+	return blacklistPrefix + tokenString
+}
+
+// MigrateLegacyBlacklist переносит записи вида blacklist:<токен> в новый формат
+// с сохранением оставшегося TTL, чтобы отозванные токены оставались отозванными
+// до истечения exp. Безопасно запускать повторно.
+func (s *AuthService) MigrateLegacyBlacklist(ctx context.Context) (int, error) {
+	migrated := 0
+	var cursor uint64
+	for {
+		keys, next, err := s.redisService.Scan(ctx, cursor, blacklistPrefix+"*", 500).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("failed to scan blacklist in Redis: %w", err)
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, blacklistJTIPrefix) ||
+				strings.HasPrefix(key, blacklistSHA256Prefix) ||
+				strings.HasPrefix(key, blacklistSIDPrefix) {
+				continue
+			}
+			ok, err := s.migrateLegacyBlacklistKey(ctx, key)
+			if err != nil {
+				return migrated, err
+			}
+			if ok {
+				migrated++
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return migrated, nil
+		}
+	}
+}
+
+func (s *AuthService) migrateLegacyBlacklistKey(ctx context.Context, key string) (bool, error) {
+	tokenString := strings.TrimPrefix(key, blacklistPrefix)
+	ttl, err := s.redisService.PTTL(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read blacklist TTL in Redis: %w", err)
+	}
+	// -2: ключ уже удалён, -1: ключ без TTL (в старом формате таких не бывает)
+	if ttl == -2 {
+		return false, nil
+	}
+	if ttl < 0 {
+		ttl = s.jwtService.AccessTTL()
+	}
+	userID, err := s.redisService.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// ключ истёк между PTTL и GET
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read legacy blacklist entry in Redis: %w", err)
+	}
+	claims := &model.AuthClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		slog.Warn("legacy blacklist entry is not a JWT, hashing as is", "error", err)
+	}
+	if err := s.redisService.Set(ctx, blacklistKey(claims.ID, tokenString), userID, ttl).Err(); err != nil {
+		return false, fmt.Errorf("failed to migrate blacklist entry in Redis: %w", err)
+	}
+	if err := s.redisService.Del(ctx, key).Err(); err != nil {
+		return false, fmt.Errorf("failed to delete legacy blacklist entry in Redis: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"friend-help/internal/model"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultEmailVerificationTTLHours = 24
+	verifyEmailCooldownPrefix        = "verify_email_sent:"
+	verifyEmailCooldown              = time.Minute
+)
+
+type emailVerificationConfig struct {
+	required bool
+	ttl      time.Duration
+	linkURL  string
+}
+
+// loadEmailVerificationConfig читает REQUIRE_EMAIL_VERIFICATION, EMAIL_VERIFICATION_TTL_HOURS
+// и EMAIL_VERIFICATION_URL. Без EMAIL_VERIFICATION_URL ссылка строится от JWT_ISSUER.
+func loadEmailVerificationConfig(issuer string) (emailVerificationConfig, error) {
+	cfg := emailVerificationConfig{ttl: defaultEmailVerificationTTLHours * time.Hour}
+	if v := os.Getenv("REQUIRE_EMAIL_VERIFICATION"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("var REQUIRE_EMAIL_VERIFICATION bad format: %q", v)
+		}
+		cfg.required = required
+	}
+	if v := os.Getenv("EMAIL_VERIFICATION_TTL_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			return cfg, fmt.Errorf("var EMAIL_VERIFICATION_TTL_HOURS bad format: %q", v)
+		}
+		cfg.ttl = time.Duration(hours) * time.Hour
+	}
+	cfg.linkURL = os.Getenv("EMAIL_VERIFICATION_URL")
+	if cfg.linkURL == "" && issuer != "" {
+		cfg.linkURL = issuer + "/api/auth/verify-email"
+	}
+	if cfg.required && cfg.linkURL == "" {
+		return cfg, errors.New("var EMAIL_VERIFICATION_URL not found (or set JWT_ISSUER)")
+	}
+	return cfg, nil
+}
+
+func (s *AuthService) EmailVerificationRequired() bool {
+	return s.emailVerification.required
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *model.AuthUser, lang string) error {
+	if user.Email == nil || *user.Email == "" {
+		return errs.ErrEmailRequired
+	}
+	token, err := s.issueActionToken(ctx, PurposeVerifyEmail, user, s.emailVerification.ttl)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(s.emailVerification.linkURL)
+	if err != nil {
+		return fmt.Errorf("var EMAIL_VERIFICATION_URL bad format: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	msg, err := mail.Render("verify_email", lang, *user.Email, map[string]interface{}{
+		"Login":    user.Login,
+		"Link":     link.String(),
+		"TTLHours": int(s.emailVerification.ttl.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// VerifyEmail гасит токен подтверждения и активирует учётную запись.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) (int, error) {
+	claims, err := s.consumeActionToken(ctx, token, PurposeVerifyEmail)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.authRepo.ActivateUser(ctx, claims.UserID); err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ResendVerificationEmail повторно отправляет письмо не чаще раза в минуту.
+// Ошибок наружу не возвращает, а пишет их в лог: ответ не должен отличаться
+// для неизвестных, уже подтверждённых и неподтверждённых учётных записей.
+func (s *AuthService) ResendVerificationEmail(ctx context.Context, identifier string, lang string) {
+	user, err := s.authRepo.GetUserByLoginOrEmail(ctx, identifier)
+	if err != nil {
+		if !errors.Is(err, errs.ErrUserNotFound) {
+			slog.ErrorContext(ctx, "failed to look up user for verification email", "error", err)
+		}
+		return
+	}
+	if user.IsActivated || user.Email == nil || *user.Email == "" {
+		return
+	}
+	fresh, err := s.redisService.SetNX(ctx, verifyEmailCooldownPrefix+strconv.Itoa(user.ID), 1, verifyEmailCooldown).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check resend cooldown in Redis", "user_id", user.ID, "error", err)
+		return
+	}
+	if !fresh {
+		return
+	}
+	if err := s.sendVerificationEmail(ctx, user, lang); err != nil {
+		slog.ErrorContext(ctx, "failed to resend verification email", "user_id", user.ID, "error", err)
+	}
+}
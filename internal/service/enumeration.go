@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"friend-help/internal/model"
+	"friend-help/internal/passhash"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Защита от перечисления пользователей. Вход для несуществующего логина
+// сравнивает пароль с фиктивным хешем, чтобы время ответа не выдавало,
+// зарегистрирован ли логин. Регистрация в безопасном режиме
+// (REGISTRATION_ENUMERATION_SAFE) всегда отвечает одинаково, а о занятом
+// логине или email сообщает письмом владельцу адреса.
+const (
+	registrationNoticeCooldownPrefix = "reg_notice_sent:"
+	registrationNoticeCooldown       = 15 * time.Minute
+)
+
+// newDummyPasswordHash готовит хеш случайного пароля тем же алгоритмом и с теми же
+// параметрами, что и настоящие.
+func newDummyPasswordHash(hasher passhash.PasswordHasher) (string, error) {
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+	hash, err := hasher.Hash(string(password))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedHashPass, err)
+	}
+	return hash, nil
+}
+
+// burnPasswordCheck тратит на несуществующего пользователя столько же времени,
+// сколько на проверку настоящего пароля.
+func (s *AuthService) burnPasswordCheck(password string) {
+	_, _ = s.hasher.Verify(s.dummyPasswordHash, password)
+}
+
+// loadEnumerationSafeRegistration читает REGISTRATION_ENUMERATION_SAFE. Режим требует
+// подтверждения email: иначе ответ с токенами отличался бы от ответа для занятых данных.
+func loadEnumerationSafeRegistration(verification emailVerificationConfig) (bool, error) {
+	v := os.Getenv("REGISTRATION_ENUMERATION_SAFE")
+	if v == "" {
+		return false, nil
+	}
+	safe, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("var REGISTRATION_ENUMERATION_SAFE bad format: %q", v)
+	}
+	if safe && !verification.required {
+		return false, errors.New("var REGISTRATION_ENUMERATION_SAFE requires REQUIRE_EMAIL_VERIFICATION=true")
+	}
+	return safe, nil
+}
+
+func (s *AuthService) EnumerationSafeRegistration() bool {
+	return s.enumerationSafeRegistration
+}
+
+// notifyRegistrationConflict сообщает на адрес из заявки, почему учётная запись
+// не создана: email уже привязан к учётной записи либо занят логин.
+// Письма на один адрес уходят не чаще раза в registrationNoticeCooldown.
+func (s *AuthService) notifyRegistrationConflict(ctx context.Context, req model.AuthRegReq, lang string) error {
+	emailKey := hashRefreshToken(strings.ToLower(req.Email))
+	fresh, err := s.redisService.SetNX(ctx, registrationNoticeCooldownPrefix+emailKey, 1, registrationNoticeCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check registration notice cooldown in Redis: %w", err)
+	}
+	if !fresh {
+		return nil
+	}
+	owner, err := s.authRepo.GetUserByLoginOrEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, errs.ErrUserNotFound) {
+		return err
+	}
+	var msg mail.Message
+	if owner != nil {
+		msg, err = mail.Render("account_exists", lang, req.Email, map[string]interface{}{"Login": owner.Login})
+	} else {
+		msg, err = mail.Render("login_taken", lang, req.Email, map[string]interface{}{"Login": req.Login})
+	}
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/passhash"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingHasher запоминает хеши, с которыми вызывался Verify.
+type countingHasher struct {
+	passhash.PasswordHasher
+	mu       sync.Mutex
+	verified []string
+}
+
+func (h *countingHasher) Verify(encoded, password string) (bool, error) {
+	h.mu.Lock()
+	h.verified = append(h.verified, encoded)
+	h.mu.Unlock()
+	return h.PasswordHasher.Verify(encoded, password)
+}
+
+func (e *testEnv) countVerify() *countingHasher {
+	h := &countingHasher{PasswordHasher: e.svc.hasher}
+	e.svc.hasher = h
+	return h
+}
+
+func TestAuthenticateUnknownUserVerifiesDummyHash(t *testing.T) {
+	env := newTestService(t, nil)
+	hasher := env.countVerify()
+
+	_, err := env.svc.Authenticate(context.Background(), "nobody", "Correct-horse-42", testClient)
+	if !errors.Is(err, errs.ErrUserNotFound) {
+		t.Fatalf("Authenticate unknown user: err = %v, want ErrUserNotFound", err)
+	}
+	if want := []string{env.svc.dummyPasswordHash}; !reflect.DeepEqual(hasher.verified, want) {
+		t.Fatalf("verified hashes = %q, want only the dummy hash", hasher.verified)
+	}
+	if !strings.HasPrefix(env.svc.dummyPasswordHash, "$argon2id$") || env.svc.hasher.NeedsRehash(env.svc.dummyPasswordHash) {
+		t.Fatalf("dummy hash %q is not made with the current parameters", env.svc.dummyPasswordHash)
+	}
+}
+
+func TestAuthenticateKnownUserVerifiesOwnHash(t *testing.T) {
+	env := newTestService(t, nil)
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	hasher := env.countVerify()
+
+	_, err := env.svc.Authenticate(context.Background(), "alice", "Wrong-horse-42", testClient)
+	if !errors.Is(err, errs.ErrInvalidLoginOrPass) {
+		t.Fatalf("Authenticate wrong password: err = %v, want ErrInvalidLoginOrPass", err)
+	}
+	if want := []string{user.PasswordHash}; !reflect.DeepEqual(hasher.verified, want) {
+		t.Fatalf("verified hashes = %q, want only the user's hash", hasher.verified)
+	}
+}
+
+var enumerationSafeEnv = map[string]string{
+	"REQUIRE_EMAIL_VERIFICATION":    "true",
+	"EMAIL_VERIFICATION_URL":        "https://app.example.com/verify",
+	"REGISTRATION_ENUMERATION_SAFE": "true",
+}
+
+func TestRegNewUserConflictLooksLikeSignup(t *testing.T) {
+	env := newTestService(t, enumerationSafeEnv)
+	env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+
+	freshID, freshTokens, freshErr := env.svc.RegNewUser(ctx, model.AuthRegReq{
+		Login: "bob", Email: "bob@example.com", Password: "Battery-staple-17",
+	}, testClient)
+	if freshErr != nil {
+		t.Fatalf("fresh signup: %v", freshErr)
+	}
+
+	conflicts := []model.AuthRegReq{
+		{Login: "alice", Email: "other@example.com", Password: "Battery-staple-17"},
+		{Login: "carol", Email: "alice@example.com", Password: "Battery-staple-17"},
+	}
+	for _, req := range conflicts {
+		id, tokens, err := env.svc.RegNewUser(ctx, req, testClient)
+		if id != freshID || tokens != freshTokens || err != freshErr {
+			t.Errorf("conflict %s/%s = (%d, %v, %v), fresh signup = (%d, %v, %v)",
+				req.Login, req.Email, id, tokens, err, freshID, freshTokens, freshErr)
+		}
+	}
+
+	// письма: подтверждение для bob и по одному уведомлению на каждый занятый адрес
+	var recipients []string
+	for _, msg := range env.mailer.messages() {
+		recipients = append(recipients, msg.To)
+	}
+	want := []string{"bob@example.com", "other@example.com", "alice@example.com"}
+	if !reflect.DeepEqual(recipients, want) {
+		t.Fatalf("mail recipients = %q, want %q", recipients, want)
+	}
+}
+
+func TestRegNewUserConflictWithoutSafeMode(t *testing.T) {
+	env := newTestService(t, nil)
+	env.addUser(t, "alice", "Correct-horse-42")
+
+	_, _, err := env.svc.RegNewUser(context.Background(), model.AuthRegReq{
+		Login: "alice", Email: "new@example.com", Password: "Battery-staple-17",
+	}, testClient)
+	if !errors.Is(err, errs.ErrUserExists) {
+		t.Fatalf("RegNewUser conflict: err = %v, want ErrUserExists", err)
+	}
+}
+
+// Проверка паритета времени: хешер с настоящими параметрами (argon2id по
+// умолчанию), медиана из timingRuns замеров на каждую ветку, расхождение
+// медиан не больше timingTolerance от большей из них.
+const (
+	timingRuns      = 7
+	timingTolerance = 0.25
+)
+
+// realHasherEnv возвращает параметры argon2id по умолчанию и отключает
+// блокировку входа, которую иначе включили бы повторные неудачи.
+var realHasherEnv = map[string]string{
+	"ARGON2_MEMORY_KIB":          "",
+	"ARGON2_ITERATIONS":          "",
+	"ARGON2_PARALLELISM":         "",
+	"LOGIN_MAX_ACCOUNT_FAILURES": "0",
+	"LOGIN_MAX_IP_FAILURES":      "0",
+}
+
+// medianDurations замеряет a и b поочерёдно, чтобы фоновая нагрузка
+// распределялась между ними поровну, и возвращает медианы.
+func medianDurations(t *testing.T, a, b func(i int)) (time.Duration, time.Duration) {
+	t.Helper()
+	var da, db []time.Duration
+	for i := range timingRuns {
+		start := time.Now()
+		a(i)
+		da = append(da, time.Since(start))
+		start = time.Now()
+		b(i)
+		db = append(db, time.Since(start))
+	}
+	slices.Sort(da)
+	slices.Sort(db)
+	return da[timingRuns/2], db[timingRuns/2]
+}
+
+func assertSimilarDurations(t *testing.T, nameA string, a time.Duration, nameB string, b time.Duration) {
+	t.Helper()
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	if limit := time.Duration(float64(max(a, b)) * timingTolerance); diff > limit {
+		t.Fatalf("%s took %v, %s took %v: difference %v exceeds %.0f%%", nameA, a, nameB, b, diff, timingTolerance*100)
+	}
+	t.Logf("%s: %v, %s: %v", nameA, a, nameB, b)
+}
+
+func TestAuthenticateTimingParity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test hashes with production parameters")
+	}
+	env := newTestService(t, realHasherEnv)
+	env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+
+	unknown, wrongPassword := medianDurations(t,
+		func(int) {
+			if _, err := env.svc.Authenticate(ctx, "nobody", "Wrong-horse-42", testClient); !errors.Is(err, errs.ErrUserNotFound) {
+				t.Fatalf("Authenticate unknown user: %v", err)
+			}
+		},
+		func(int) {
+			if _, err := env.svc.Authenticate(ctx, "alice", "Wrong-horse-42", testClient); !errors.Is(err, errs.ErrInvalidLoginOrPass) {
+				t.Fatalf("Authenticate wrong password: %v", err)
+			}
+		})
+	assertSimilarDurations(t, "unknown login", unknown, "wrong password", wrongPassword)
+}
+
+func TestRegNewUserTimingParity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test hashes with production parameters")
+	}
+	env := newTestService(t, mergeEnv(realHasherEnv, enumerationSafeEnv))
+	env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+
+	taken, free := medianDurations(t,
+		func(i int) {
+			if _, _, err := env.svc.RegNewUser(ctx, model.AuthRegReq{
+				Login: "alice", Email: fmt.Sprintf("taken%d@example.com", i), Password: "Battery-staple-17",
+			}, testClient); err != nil {
+				t.Fatalf("RegNewUser taken login: %v", err)
+			}
+		},
+		func(i int) {
+			if _, _, err := env.svc.RegNewUser(ctx, model.AuthRegReq{
+				Login: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("free%d@example.com", i), Password: "Battery-staple-17",
+			}, testClient); err != nil {
+				t.Fatalf("RegNewUser free login: %v", err)
+			}
+		})
+	assertSimilarDurations(t, "taken login", taken, "free login", free)
+}
+
+func mergeEnv(envs ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, env := range envs {
+		for k, v := range env {
+			merged[k] = v
+		}
+	}
+	return merged
+}
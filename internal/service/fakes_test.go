@@ -0,0 +1,510 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"friend-help/internal/cache"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"friend-help/internal/model"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// memStore — хранилище в памяти вместо MySQL: реализует AuthRepo, SessionRepo,
+// MFARepo и AuditRepo настолько, насколько их поведение важно сервису.
+type memStore struct {
+	mu              sync.Mutex
+	users           map[int]*model.AuthUser
+	passwordHistory map[int][]string
+	sessions        map[string]*model.Session
+	totp            map[int]*model.TOTPSecret
+	recoveryCodes   []model.RecoveryCode
+	usedCodes       map[int]bool
+	handles         map[int][]byte
+	credentials     []model.WebAuthnCredential
+	audit           []model.AuditEvent
+	nextID          int
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		users:           map[int]*model.AuthUser{},
+		passwordHistory: map[int][]string{},
+		sessions:        map[string]*model.Session{},
+		totp:            map[int]*model.TOTPSecret{},
+		usedCodes:       map[int]bool{},
+		handles:         map[int][]byte{},
+	}
+}
+
+func (m *memStore) id() int {
+	m.nextID++
+	return m.nextID
+}
+
+func (m *memStore) CheckUserExists(ctx context.Context, login, email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Login == login || (email != "" && u.Email != nil && *u.Email == email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memStore) CreateUser(ctx context.Context, user model.AuthUser) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.ID = m.id()
+	user.PasswordChangedAt = time.Now()
+	m.users[user.ID] = &user
+	return user.ID, nil
+}
+
+func (m *memStore) GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Login == identifier || (u.Email != nil && *u.Email == identifier) {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, errs.ErrUserNotFound
+}
+
+func (m *memStore) GetUserByID(ctx context.Context, userID int) (*model.AuthUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return nil, errs.ErrUserNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (m *memStore) GetTokenVersion(ctx context.Context, userID int) (int, error) {
+	user, err := m.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
+
+func (m *memStore) IncrementTokenVersion(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return 0, errs.ErrUserNotFound
+	}
+	u.TokenVersion++
+	return u.TokenVersion, nil
+}
+
+func (m *memStore) SetUserRole(ctx context.Context, userID int, role int) error {
+	return m.updateUser(userID, func(u *model.AuthUser) { u.Role = role })
+}
+
+func (m *memStore) ActivateUser(ctx context.Context, userID int) error {
+	return m.updateUser(userID, func(u *model.AuthUser) { u.IsActivated = true })
+}
+
+func (m *memStore) UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	return m.updateUser(userID, func(u *model.AuthUser) { u.PasswordHash = passwordHash })
+}
+
+func (m *memStore) ChangePasswordHash(ctx context.Context, userID int, passwordHash string, keepHistory int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return errs.ErrUserNotFound
+	}
+	history := append([]string{u.PasswordHash}, m.passwordHistory[userID]...)
+	m.passwordHistory[userID] = history[:min(keepHistory, len(history))]
+	u.PasswordHash = passwordHash
+	u.PasswordChangedAt = time.Now()
+	return nil
+}
+
+func (m *memStore) GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := m.passwordHistory[userID]
+	return slices.Clone(history[:min(limit, len(history))]), nil
+}
+
+func (m *memStore) GetRolePermissions(ctx context.Context, role int) ([]string, error) {
+	return nil, nil
+}
+
+func (m *memStore) updateUser(userID int, update func(*model.AuthUser)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return errs.ErrUserNotFound
+	}
+	update(u)
+	return nil
+}
+
+func (m *memStore) CreateSession(ctx context.Context, session model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	m.sessions[session.ID] = &session
+	return nil
+}
+
+func (m *memStore) GetSession(ctx context.Context, sessionID string) (*model.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, errs.ErrSessionNotFound
+	}
+	session := *s
+	return &session, nil
+}
+
+func (m *memStore) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []model.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && s.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, *s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memStore) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	return m.updateSession(sessionID, func(s *model.Session) { s.LastSeenAt = seenAt })
+}
+
+func (m *memStore) ExtendSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	return m.updateSession(sessionID, func(s *model.Session) { s.ExpiresAt = expiresAt })
+}
+
+func (m *memStore) RevokeSession(ctx context.Context, sessionID string) error {
+	return m.updateSession(sessionID, func(s *model.Session) {
+		if s.RevokedAt == nil {
+			now := time.Now()
+			s.RevokedAt = &now
+		}
+	})
+}
+
+func (m *memStore) RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	now := time.Now()
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptSessionID && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			s.RevokedAt = &now
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *memStore) updateSession(sessionID string, update func(*model.Session)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[sessionID]; ok {
+		update(s)
+	}
+	return nil
+}
+
+func (m *memStore) SaveTOTP(ctx context.Context, userID int, secretEnc []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.totp[userID]; ok && existing.ConfirmedAt != nil {
+		return nil
+	}
+	m.totp[userID] = &model.TOTPSecret{UserID: userID, SecretEnc: secretEnc}
+	return nil
+}
+
+func (m *memStore) GetTOTP(ctx context.Context, userID int) (*model.TOTPSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.totp[userID]
+	if !ok {
+		return nil, errs.ErrTOTPNotEnabled
+	}
+	secret := *record
+	return &secret, nil
+}
+
+func (m *memStore) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	record, ok := m.totp[userID]
+	if !ok || record.ConfirmedAt != nil {
+		m.mu.Unlock()
+		return errs.ErrTOTPNotEnabled
+	}
+	now := time.Now()
+	record.ConfirmedAt = &now
+	record.LastStep = step
+	m.mu.Unlock()
+	return m.ReplaceRecoveryCodes(ctx, userID, recoveryCodeHashes)
+}
+
+func (m *memStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.totp[userID]
+	if !ok || record.LastStep >= step {
+		return false, nil
+	}
+	record.LastStep = step
+	return true, nil
+}
+
+func (m *memStore) DeleteTOTP(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.totp, userID)
+	m.dropOrphanRecoveryCodes(userID)
+	return nil
+}
+
+// dropOrphanRecoveryCodes удаляет коды восстановления пользователя без второго фактора.
+func (m *memStore) dropOrphanRecoveryCodes(userID int) {
+	if record, ok := m.totp[userID]; ok && record.ConfirmedAt != nil {
+		return
+	}
+	if slices.ContainsFunc(m.credentials, func(c model.WebAuthnCredential) bool { return c.UserID == userID }) {
+		return
+	}
+	m.recoveryCodes = slices.DeleteFunc(m.recoveryCodes, func(c model.RecoveryCode) bool { return c.UserID == userID })
+}
+
+func (m *memStore) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recoveryCodes = slices.DeleteFunc(m.recoveryCodes, func(c model.RecoveryCode) bool { return c.UserID == userID })
+	for _, hash := range codeHashes {
+		m.recoveryCodes = append(m.recoveryCodes, model.RecoveryCode{ID: m.id(), UserID: userID, CodeHash: hash})
+	}
+	return nil
+}
+
+func (m *memStore) ListUnusedRecoveryCodes(ctx context.Context, userID int) ([]model.RecoveryCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var codes []model.RecoveryCode
+	for _, c := range m.recoveryCodes {
+		if c.UserID == userID && !m.usedCodes[c.ID] {
+			codes = append(codes, c)
+		}
+	}
+	return codes, nil
+}
+
+func (m *memStore) UseRecoveryCode(ctx context.Context, codeID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usedCodes[codeID] {
+		return false, nil
+	}
+	m.usedCodes[codeID] = true
+	return true, nil
+}
+
+func (m *memStore) EnsureWebAuthnHandle(ctx context.Context, userID int, candidate []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if handle, ok := m.handles[userID]; ok {
+		return handle, nil
+	}
+	m.handles[userID] = candidate
+	return candidate, nil
+}
+
+func (m *memStore) GetUserIDByWebAuthnHandle(ctx context.Context, handle []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for userID, h := range m.handles {
+		if bytes.Equal(h, handle) {
+			return userID, nil
+		}
+	}
+	return 0, errs.ErrWebAuthnCredentialNotFound
+}
+
+func (m *memStore) AddWebAuthnCredential(ctx context.Context, credential model.WebAuthnCredential) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.credentials {
+		if bytes.Equal(c.CredentialID, credential.CredentialID) {
+			return 0, errs.ErrWebAuthnCredentialExists
+		}
+	}
+	credential.ID = m.id()
+	credential.CreatedAt = time.Now()
+	m.credentials = append(m.credentials, credential)
+	return credential.ID, nil
+}
+
+func (m *memStore) ListWebAuthnCredentials(ctx context.Context, userID int) ([]model.WebAuthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var credentials []model.WebAuthnCredential
+	for _, c := range m.credentials {
+		if c.UserID == userID {
+			credentials = append(credentials, c)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *memStore) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.credentials {
+		if bytes.Equal(m.credentials[i].CredentialID, credentialID) {
+			now := time.Now()
+			m.credentials[i].SignCount = signCount
+			m.credentials[i].BackupState = backupState
+			m.credentials[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memStore) DeleteWebAuthnCredential(ctx context.Context, userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.credentials)
+	m.credentials = slices.DeleteFunc(m.credentials, func(c model.WebAuthnCredential) bool { return c.UserID == userID && c.ID == id })
+	if len(m.credentials) == n {
+		return errs.ErrWebAuthnCredentialNotFound
+	}
+	m.dropOrphanRecoveryCodes(userID)
+	return nil
+}
+
+func (m *memStore) Record(ctx context.Context, event model.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, event)
+	return nil
+}
+
+// memMailer запоминает отправленные письма.
+type memMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *memMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *memMailer) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.sent)
+}
+
+type testEnv struct {
+	svc    *AuthService
+	store  *memStore
+	mailer *memMailer
+	redis  *miniredis.Miniredis
+}
+
+// newTestService собирает AuthService поверх memStore и miniredis. env
+// дополняет и переопределяет базовую конфигурацию; argon2id с минимальными
+// параметрами, чтобы тесты не тратили время на хеширование.
+func newTestService(t *testing.T, env map[string]string) *testEnv {
+	t.Helper()
+	redisServer := miniredis.RunT(t)
+	redisServer.RequireAuth("test")
+	key := make([]byte, 32)
+	rand.Read(key)
+	base := map[string]string{
+		"REDIS_ADDR":              redisServer.Addr(),
+		"REDIS_PASS":              "test",
+		"JWT_ALG":                 "HS256",
+		"JWT_SECRET_KEY":          "test-secret-key-of-sufficient-length",
+		"JWT_ISSUER":              "https://auth.example.com",
+		"MFA_ENCRYPTION_KEY":      base64.StdEncoding.EncodeToString(key),
+		"PASSWORD_HASH_ALGORITHM": "argon2id",
+		"ARGON2_MEMORY_KIB":       "64",
+		"ARGON2_ITERATIONS":       "1",
+		"ARGON2_PARALLELISM":      "1",
+	}
+	for k, v := range env {
+		base[k] = v
+	}
+	for k, v := range base {
+		t.Setenv(k, v)
+	}
+	redisService, err := cache.NewRedisService()
+	if err != nil {
+		t.Fatalf("NewRedisService: %v", err)
+	}
+	jwtService, err := NewJwtService()
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	store := newMemStore()
+	mailer := &memMailer{}
+	svc, err := NewAuthService(store, store, store, store, jwtService, redisService, mailer)
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	return &testEnv{svc: svc, store: store, mailer: mailer, redis: redisServer}
+}
+
+// addUser создаёт активного пользователя с паролем password.
+func (e *testEnv) addUser(t *testing.T, login, password string) *model.AuthUser {
+	t.Helper()
+	hash, err := e.svc.hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	email := strings.ToLower(login) + "@example.com"
+	id, err := e.store.CreateUser(context.Background(), model.AuthUser{
+		Login:        login,
+		Username:     login,
+		Email:        &email,
+		PasswordHash: hash,
+		IsActivated:  true,
+		Role:         model.Member,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	user, _ := e.store.GetUserByID(context.Background(), id)
+	return user
+}
+
+// redisExists проверяет ключ в той же базе Redis, которую выбирает cache.NewRedisService.
+func (e *testEnv) redisExists(key string) bool {
+	return e.redis.DB(1).Exists(key)
+}
+
+var testClient = model.ClientInfo{IP: "203.0.113.7", UserAgent: "go-test"}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultJWTAlg = "HS256"
+
+// signingKey — ключ вместе с алгоритмом, под который он загружен.
+// Для HMAC private и public содержат один и тот же секрет.
+type signingKey struct {
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+func loadSigningKeyFromEnv() (*signingKey, error) {
+	alg := os.Getenv("JWT_ALG")
+	if alg == "" {
+		alg = defaultJWTAlg
+	}
+	method, err := signingMethodByAlg(alg)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		JWTSecretKey := os.Getenv("JWT_SECRET_KEY")
+		if JWTSecretKey == "" {
+			return nil, errors.New("var JWT_SECRET_KEY not found")
+		}
+		return &signingKey{method: method, private: []byte(JWTSecretKey), public: []byte(JWTSecretKey)}, nil
+	}
+	keyPath := os.Getenv("JWT_PRIVATE_KEY_PATH")
+	if keyPath == "" {
+		return nil, fmt.Errorf("var JWT_PRIVATE_KEY_PATH not found (required for %s)", alg)
+	}
+	pemData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+	}
+	return parsePrivateKeyPEM(method, pemData)
+}
+
+func signingMethodByAlg(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "HS256", "HS384", "HS512",
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA":
+		return jwt.GetSigningMethod(alg), nil
+	}
+	return nil, fmt.Errorf("%w: %q", errs.ErrUnsupportedSigningAlg, alg)
+}
+
+func parsePrivateKeyPEM(method jwt.SigningMethod, pemData []byte) (*signingKey, error) {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidSigningKey, err)
+		}
+		return &signingKey{method: method, private: key, public: &key.PublicKey}, nil
+	case *jwt.SigningMethodECDSA:
+		key, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidSigningKey, err)
+		}
+		if key.Curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf("%w: curve %s does not match %s", errs.ErrInvalidSigningKey, key.Curve.Params().Name, m.Alg())
+		}
+		return &signingKey{method: method, private: key, public: &key.PublicKey}, nil
+	case *jwt.SigningMethodEd25519:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidSigningKey, err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an Ed25519 key", errs.ErrInvalidSigningKey)
+		}
+		return &signingKey{method: method, private: edKey, public: edKey.Public()}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", errs.ErrUnsupportedSigningAlg, method.Alg())
+}
+
+// publicJWK описывает публичную часть ключа в формате RFC 7517.
+// HMAC-секреты никогда не публикуются: для них ok == false.
+func publicJWK(kid string, key *signingKey) (model.JWK, bool) {
+	jwk := model.JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := pub.ECDH()
+		if err != nil {
+			return model.JWK{}, false
+		}
+		raw := point.Bytes()[1:]
+		size := len(raw) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[:size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return model.JWK{}, false
+	}
+	return jwk, true
+}
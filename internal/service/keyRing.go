@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"friend-help/internal/errs"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultKeyID             = "default"
+	defaultKeysReloadSeconds = 60
+)
+
+// keysManifest — формат файла JWT_KEYS_FILE.
+//
+//	{
+//	  "signing_kid": "2025-10",
+//	  "legacy_kid": "2025-01",
+//	  "keys": [
+//	    {"kid": "2025-10", "alg": "ES256", "key_path": "/keys/2025-10.pem"},
+//	    {"kid": "2025-01", "alg": "HS256", "key_path": "/keys/old.secret", "retire_at": "2025-12-01T00:00:00Z"}
+//	  ]
+//	}
+//
+// Для HS* key_path указывает на файл с секретом, для остальных — на PEM с приватным ключом.
+// legacy_kid — ключ для проверки старых токенов без заголовка kid.
+type keysManifest struct {
+	SigningKID string          `json:"signing_kid"`
+	LegacyKID  string          `json:"legacy_kid,omitempty"`
+	Keys       []manifestEntry `json:"keys"`
+}
+
+type manifestEntry struct {
+	KID      string     `json:"kid"`
+	Alg      string     `json:"alg"`
+	KeyPath  string     `json:"key_path"`
+	RetireAt *time.Time `json:"retire_at,omitempty"`
+}
+
+type ringKey struct {
+	*signingKey
+	id       string
+	retireAt time.Time
+}
+
+func (k *ringKey) retired(now time.Time) bool {
+	return !k.retireAt.IsZero() && !now.Before(k.retireAt)
+}
+
+type keyRing struct {
+	mu        sync.RWMutex
+	keys      map[string]*ringKey
+	signingID string
+	legacyID  string
+
+	manifestPath    string
+	manifestModTime time.Time
+}
+
+func newKeyRingFromEnv() (*keyRing, error) {
+	ring := &keyRing{manifestPath: os.Getenv("JWT_KEYS_FILE")}
+	if ring.manifestPath != "" {
+		if err := ring.reload(); err != nil {
+			return nil, err
+		}
+		return ring, nil
+	}
+	key, err := loadSigningKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	kid := os.Getenv("JWT_KEY_ID")
+	if kid == "" {
+		kid = defaultKeyID
+	}
+	ring.keys = map[string]*ringKey{kid: {signingKey: key, id: kid}}
+	ring.signingID = kid
+	ring.legacyID = kid
+	return ring, nil
+}
+
+// reload перечитывает манифест и атомарно заменяет набор ключей.
+// При любой ошибке остаётся прежний набор.
+func (r *keyRing) reload() error {
+	info, err := os.Stat(r.manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat JWT keys file: %w", err)
+	}
+	data, err := os.ReadFile(r.manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read JWT keys file: %w", err)
+	}
+	var manifest keysManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("JWT keys file bad format: %w", err)
+	}
+	keys := make(map[string]*ringKey, len(manifest.Keys))
+	for _, entry := range manifest.Keys {
+		if entry.KID == "" {
+			return fmt.Errorf("%w: key without kid", errs.ErrInvalidSigningKey)
+		}
+		if _, dup := keys[entry.KID]; dup {
+			return fmt.Errorf("%w: duplicate kid %q", errs.ErrInvalidSigningKey, entry.KID)
+		}
+		key, err := loadManifestKey(entry)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", entry.KID, err)
+		}
+		rk := &ringKey{signingKey: key, id: entry.KID}
+		if entry.RetireAt != nil {
+			rk.retireAt = *entry.RetireAt
+		}
+		keys[entry.KID] = rk
+	}
+	signing, ok := keys[manifest.SigningKID]
+	if !ok {
+		return fmt.Errorf("%w: signing_kid %q not found in keys", errs.ErrInvalidSigningKey, manifest.SigningKID)
+	}
+	if signing.retired(time.Now()) {
+		return fmt.Errorf("%w: signing key %q is retired", errs.ErrInvalidSigningKey, manifest.SigningKID)
+	}
+	if manifest.LegacyKID != "" {
+		if _, ok := keys[manifest.LegacyKID]; !ok {
+			return fmt.Errorf("%w: legacy_kid %q not found in keys", errs.ErrInvalidSigningKey, manifest.LegacyKID)
+		}
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.signingID = manifest.SigningKID
+	r.legacyID = manifest.LegacyKID
+	r.manifestModTime = info.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+func loadManifestKey(entry manifestEntry) (*signingKey, error) {
+	method, err := signingMethodByAlg(entry.Alg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(entry.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		secret := []byte(strings.TrimRight(string(data), "\r\n"))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("%w: empty secret", errs.ErrInvalidSigningKey)
+		}
+		return &signingKey{method: method, private: secret, public: secret}, nil
+	}
+	return parsePrivateKeyPEM(method, data)
+}
+
+// signing возвращает ключ для подписи новых токенов. Если retire_at
+// подписывающего ключа наступил уже после загрузки манифеста, подписывать
+// им нельзя: такие токены отвергнет любая проверка.
+func (r *keyRing) signing() (*ringKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key := r.keys[r.signingID]
+	if key.retired(time.Now()) {
+		return nil, fmt.Errorf("%w: signing key %q is retired", errs.ErrInvalidSigningKey, key.id)
+	}
+	return key, nil
+}
+
+// verificationKey возвращает ключ по kid; пустой kid означает токен,
+// выпущенный до появления заголовка kid.
+func (r *keyRing) verificationKey(kid string) (*ringKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if kid == "" {
+		kid = r.legacyID
+	}
+	key, ok := r.keys[kid]
+	if !ok || kid == "" {
+		return nil, errs.ErrUnknownKeyID
+	}
+	if key.retired(time.Now()) {
+		return nil, errs.ErrRetiredKeyID
+	}
+	return key, nil
+}
+
+// active возвращает ключи, ещё пригодные для проверки, в порядке kid.
+func (r *keyRing) active() []*ringKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	keys := make([]*ringKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.retired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, k int) bool { return keys[i].id < keys[k].id })
+	return keys
+}
+
+// watch перечитывает манифест при изменении mtime, пока не отменён ctx.
+func (r *keyRing) watch(ctx context.Context, interval time.Duration) {
+	if r.manifestPath == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.signing(); err != nil {
+				slog.Error("JWT tokens cannot be issued, change signing_kid in the keys file", "error", err)
+			}
+			info, err := os.Stat(r.manifestPath)
+			if err != nil {
+				slog.Error("JWT keys file is unavailable", "error", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := !info.ModTime().Equal(r.manifestModTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				slog.Error("failed to reload JWT keys, keeping previous set", "error", err)
+				continue
+			}
+			r.mu.RLock()
+			signingID := r.signingID
+			r.mu.RUnlock()
+			slog.Info("JWT keys reloaded", "signing_kid", signingID)
+		}
+	}
+}
+
+func keysReloadInterval() (time.Duration, error) {
+	seconds := defaultKeysReloadSeconds
+	if v := os.Getenv("JWT_KEYS_RELOAD_SECONDS"); v != "" {
+		var err error
+		seconds, err = strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return 0, fmt.Errorf("var JWT_KEYS_RELOAD_SECONDS bad format: %q", v)
+		}
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keysDir — каталог с HS256-секретами k1..k3 и манифестом keys.json.
+type keysDir struct {
+	dir      string
+	manifest string
+}
+
+func newKeysDir(t *testing.T) *keysDir {
+	t.Helper()
+	d := &keysDir{dir: t.TempDir()}
+	d.manifest = filepath.Join(d.dir, "keys.json")
+	for _, kid := range []string{"k1", "k2", "k3"} {
+		secret := []byte("secret-of-" + kid + "-with-sufficient-length\n")
+		if err := os.WriteFile(filepath.Join(d.dir, kid+".secret"), secret, 0o600); err != nil {
+			t.Fatalf("write secret: %v", err)
+		}
+	}
+	return d
+}
+
+func (d *keysDir) entry(kid string, retireAt *time.Time) manifestEntry {
+	return manifestEntry{KID: kid, Alg: "HS256", KeyPath: filepath.Join(d.dir, kid+".secret"), RetireAt: retireAt}
+}
+
+// write сохраняет манифест и сдвигает mtime вперёд, чтобы watch заметил
+// изменение даже на ФС с секундной точностью времени.
+func (d *keysDir) write(t *testing.T, manifest keysManifest) {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+	var mtime time.Time
+	if info, err := os.Stat(d.manifest); err == nil {
+		mtime = info.ModTime().Add(time.Second)
+	} else {
+		mtime = time.Now()
+	}
+	if err := os.WriteFile(d.manifest, data, 0o600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	if err := os.Chtimes(d.manifest, mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func newKeysJwtService(t *testing.T, d *keysDir) *JwtService {
+	t.Helper()
+	t.Setenv("JWT_KEYS_FILE", d.manifest)
+	j, err := NewJwtService()
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	return j
+}
+
+func tokenKID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &model.AuthClaims{})
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	d := newKeysDir(t)
+	d.write(t, keysManifest{SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", nil)}})
+	j := newKeysJwtService(t, d)
+	subject := model.TokenSubject{UserID: 7, Role: model.Member}
+
+	oldToken, err := j.GenToken(subject)
+	if err != nil {
+		t.Fatalf("GenToken: %v", err)
+	}
+	if kid := tokenKID(t, oldToken); kid != "k1" {
+		t.Fatalf("kid = %q, want k1", kid)
+	}
+
+	// новый подписывающий ключ; k1 проверяет выпущенные им токены до retire_at
+	retireAt := time.Now().Add(time.Hour)
+	d.write(t, keysManifest{SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", &retireAt), d.entry("k2", nil)}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go j.keys.watch(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for j.SigningKeyID() != "k2" {
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not pick up the new signing_kid")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	newToken, err := j.GenToken(subject)
+	if err != nil {
+		t.Fatalf("GenToken after rotation: %v", err)
+	}
+	if kid := tokenKID(t, newToken); kid != "k2" {
+		t.Fatalf("kid after rotation = %q, want k2", kid)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := j.ParseTokenAndGetClaims(token); err != nil {
+			t.Fatalf("%s token rejected after rotation: %v", name, err)
+		}
+	}
+	if jwks := j.JWKS(); len(jwks.Keys) != 0 {
+		t.Fatalf("JWKS published HMAC keys: %+v", jwks)
+	}
+
+	// после retire_at токены k1 больше не принимаются, k1 пропадает из active
+	past := time.Now().Add(-time.Minute)
+	d.write(t, keysManifest{SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", &past), d.entry("k2", nil)}})
+	if err := j.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if _, err := j.ParseTokenAndGetClaims(oldToken); !errors.Is(err, errs.ErrRetiredKeyID) {
+		t.Fatalf("token of a retired key: err = %v, want ErrRetiredKeyID", err)
+	}
+	if _, err := j.ParseTokenAndGetClaims(newToken); err != nil {
+		t.Fatalf("token of the signing key rejected: %v", err)
+	}
+	if active := j.keys.active(); len(active) != 1 || active[0].id != "k2" {
+		t.Fatalf("active keys = %v, want only k2", active)
+	}
+}
+
+func TestKeyRingLegacyTokensWithoutKID(t *testing.T) {
+	d := newKeysDir(t)
+	d.write(t, keysManifest{SigningKID: "k2", LegacyKID: "k1", Keys: []manifestEntry{d.entry("k1", nil), d.entry("k2", nil)}})
+	j := newKeysJwtService(t, d)
+
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, model.AuthClaims{
+		UserID:           7,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	signed := func(kid string) string {
+		t.Helper()
+		secret, err := os.ReadFile(filepath.Join(d.dir, kid+".secret"))
+		if err != nil {
+			t.Fatalf("read secret: %v", err)
+		}
+		token, err := legacy.SignedString(secret[:len(secret)-1])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return token
+	}
+	if _, err := j.ParseTokenAndGetClaims(signed("k1")); err != nil {
+		t.Fatalf("token without kid signed by legacy_kid rejected: %v", err)
+	}
+	if _, err := j.ParseTokenAndGetClaims(signed("k2")); err == nil {
+		t.Fatal("token without kid signed by another key accepted")
+	}
+
+	d.write(t, keysManifest{SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", nil), d.entry("k2", nil)}})
+	if err := j.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if _, err := j.ParseTokenAndGetClaims(signed("k1")); !errors.Is(err, errs.ErrUnknownKeyID) {
+		t.Fatalf("token without kid and no legacy_kid: err = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestKeyRingReloadKeepsPreviousSetOnError(t *testing.T) {
+	d := newKeysDir(t)
+	d.write(t, keysManifest{SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", nil)}})
+	j := newKeysJwtService(t, d)
+
+	past := time.Now().Add(-time.Minute)
+	missing := d.entry("k3", nil)
+	missing.KeyPath = filepath.Join(d.dir, "missing.secret")
+	badAlg := d.entry("k2", nil)
+	badAlg.Alg = "none"
+	cases := map[string]keysManifest{
+		"unknown signing_kid": {SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", nil)}},
+		"retired signing key": {SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", nil), d.entry("k2", &past)}},
+		"duplicate kid":       {SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", nil), d.entry("k1", nil)}},
+		"unknown legacy_kid":  {SigningKID: "k1", LegacyKID: "k9", Keys: []manifestEntry{d.entry("k1", nil)}},
+		"missing key file":    {SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", nil), missing}},
+		"unsupported alg":     {SigningKID: "k2", Keys: []manifestEntry{d.entry("k1", nil), badAlg}},
+		"key without kid":     {SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", nil), d.entry("", nil)}},
+	}
+	for name, manifest := range cases {
+		t.Run(name, func(t *testing.T) {
+			d.write(t, manifest)
+			if err := j.ReloadKeys(); err == nil {
+				t.Fatal("ReloadKeys accepted a bad manifest")
+			}
+			if kid := j.SigningKeyID(); kid != "k1" {
+				t.Fatalf("signing kid after failed reload = %q, want k1", kid)
+			}
+		})
+	}
+}
+
+func TestKeyRingRefusesToSignWithRetiredKey(t *testing.T) {
+	d := newKeysDir(t)
+	retireAt := time.Now().Add(time.Hour)
+	d.write(t, keysManifest{SigningKID: "k1", Keys: []manifestEntry{d.entry("k1", &retireAt)}})
+	j := newKeysJwtService(t, d)
+	if _, err := j.GenToken(model.TokenSubject{UserID: 7}); err != nil {
+		t.Fatalf("GenToken before retire_at: %v", err)
+	}
+
+	// retire_at наступил уже после загрузки манифеста
+	j.keys.keys["k1"].retireAt = time.Now().Add(-time.Second)
+	if _, err := j.GenToken(model.TokenSubject{UserID: 7}); !errors.Is(err, errs.ErrInvalidSigningKey) {
+		t.Fatalf("GenToken with a retired signing key: err = %v, want ErrInvalidSigningKey", err)
+	}
+	if _, _, err := j.GenActionToken(PurposeVerifyEmail, 7, 0, time.Minute); !errors.Is(err, errs.ErrInvalidSigningKey) {
+		t.Fatalf("GenActionToken with a retired signing key: err = %v, want ErrInvalidSigningKey", err)
+	}
+	if j.SigningKeyID() != "" || j.Algorithm() != "" {
+		t.Fatalf("retired signing key reported as %q/%q", j.SigningKeyID(), j.Algorithm())
+	}
+}
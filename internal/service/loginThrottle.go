@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Неудачные входы считаются отдельно по учётной записи и по IP:
+// login_fail:<scope>:<id>  -> число неудач подряд
+// login_lock:<scope>:<id>  -> блокировка; TTL ключа — сколько ещё ждать
+// Начиная с порога, каждая следующая неудача блокирует вход на вдвое больший
+// срок: base, 2*base, 4*base ... но не дольше max. Неверные коды второго
+// фактора считаются в те же счётчики. Успешный вход — после второго фактора,
+// если он подключён, — сбрасывает счётчик учётной записи; счётчик IP живёт
+// до истечения окна, чтобы свой аккаунт не помогал перебирать чужие.
+const (
+	loginFailKeyPrefix = "login_fail:"
+	loginLockKeyPrefix = "login_lock:"
+	loginScopeAccount  = "account:"
+	loginScopeIP       = "ip:"
+
+	defaultLoginMaxAccountFailures = 5
+	defaultLoginMaxIPFailures      = 20
+	defaultLoginFailureWindow      = 15 * time.Minute
+	defaultLoginLockoutBase        = time.Minute
+	defaultLoginLockoutMax         = time.Hour
+)
+
+type loginThrottleConfig struct {
+	maxAccountFailures int
+	maxIPFailures      int
+	window             time.Duration
+	lockoutBase        time.Duration
+	lockoutMax         time.Duration
+}
+
+// loadLoginThrottleConfig читает LOGIN_MAX_ACCOUNT_FAILURES, LOGIN_MAX_IP_FAILURES
+// (0 отключает соответствующий счётчик), LOGIN_FAILURE_WINDOW_MINUTES,
+// LOGIN_LOCKOUT_BASE_SECONDS и LOGIN_LOCKOUT_MAX_SECONDS.
+func loadLoginThrottleConfig() (loginThrottleConfig, error) {
+	cfg := loginThrottleConfig{
+		maxAccountFailures: defaultLoginMaxAccountFailures,
+		maxIPFailures:      defaultLoginMaxIPFailures,
+		window:             defaultLoginFailureWindow,
+		lockoutBase:        defaultLoginLockoutBase,
+		lockoutMax:         defaultLoginLockoutMax,
+	}
+	ints := []struct {
+		name     string
+		dst      *int
+		positive bool
+	}{
+		{"LOGIN_MAX_ACCOUNT_FAILURES", &cfg.maxAccountFailures, false},
+		{"LOGIN_MAX_IP_FAILURES", &cfg.maxIPFailures, false},
+	}
+	for _, v := range ints {
+		if raw := os.Getenv(v.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("var %s bad format: %q", v.name, raw)
+			}
+			*v.dst = n
+		}
+	}
+	durations := []struct {
+		name string
+		dst  *time.Duration
+		unit time.Duration
+	}{
+		{"LOGIN_FAILURE_WINDOW_MINUTES", &cfg.window, time.Minute},
+		{"LOGIN_LOCKOUT_BASE_SECONDS", &cfg.lockoutBase, time.Second},
+		{"LOGIN_LOCKOUT_MAX_SECONDS", &cfg.lockoutMax, time.Second},
+	}
+	for _, v := range durations {
+		if raw := os.Getenv(v.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("var %s bad format: %q", v.name, raw)
+			}
+			*v.dst = time.Duration(n) * v.unit
+		}
+	}
+	if cfg.lockoutMax < cfg.lockoutBase {
+		return cfg, fmt.Errorf("var LOGIN_LOCKOUT_MAX_SECONDS must not be less than LOGIN_LOCKOUT_BASE_SECONDS")
+	}
+	return cfg, nil
+}
+
+// lockoutDuration — срок блокировки после failures неудач при пороге threshold.
+func (c loginThrottleConfig) lockoutDuration(failures, threshold int) time.Duration {
+	d := c.lockoutBase
+	for i := threshold; i < failures && d < c.lockoutMax; i++ {
+		d *= 2
+	}
+	if d > c.lockoutMax {
+		d = c.lockoutMax
+	}
+	return d
+}
+
+// loginAccountKey — идентификатор учётной записи для счётчиков. Для несуществующих
+// пользователей считаем по введённому логину, чтобы блокировка вела себя одинаково.
+func loginAccountKey(userID int, identifier string) string {
+	if userID != 0 {
+		return loginScopeAccount + strconv.Itoa(userID)
+	}
+	return loginScopeAccount + "?" + strings.ToLower(identifier)
+}
+
+// checkLoginLock возвращает RetryAfterError, если для scope действует блокировка.
+func (s *AuthService) checkLoginLock(ctx context.Context, scope string, lockErr error) error {
+	ttl, err := s.redisService.PTTL(ctx, loginLockKeyPrefix+scope).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to check login lockout in Redis: %w", err)
+	}
+	if ttl > 0 {
+		return &errs.RetryAfterError{Err: lockErr, RetryAfter: ttl}
+	}
+	return nil
+}
+
+// recordLoginFailure учитывает неудачу и при достижении порога ставит блокировку.
+func (s *AuthService) recordLoginFailure(ctx context.Context, scope string, threshold int) error {
+	if threshold == 0 {
+		return nil
+	}
+	cfg := s.loginThrottle
+	failures, err := s.redisService.Incr(ctx, loginFailKeyPrefix+scope).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count login failure in Redis: %w", err)
+	}
+	lockout := time.Duration(0)
+	if int(failures) >= threshold {
+		lockout = cfg.lockoutDuration(int(failures), threshold)
+		if err := s.redisService.Set(ctx, loginLockKeyPrefix+scope, failures, lockout).Err(); err != nil {
+			return fmt.Errorf("failed to store login lockout in Redis: %w", err)
+		}
+	}
+	// счётчик переживает блокировку, иначе следующая неудача начала бы отсчёт заново
+	if err := s.redisService.Expire(ctx, loginFailKeyPrefix+scope, cfg.window+lockout).Err(); err != nil {
+		return fmt.Errorf("failed to count login failure in Redis: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) recordLoginFailures(ctx context.Context, accountKey, ip string) error {
+	if err := s.recordLoginFailure(ctx, accountKey, s.loginThrottle.maxAccountFailures); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return s.recordLoginFailure(ctx, loginScopeIP+ip, s.loginThrottle.maxIPFailures)
+}
+
+func (s *AuthService) resetLoginFailures(ctx context.Context, accountKey string) error {
+	err := s.redisService.Del(ctx, loginFailKeyPrefix+accountKey, loginLockKeyPrefix+accountKey).Err()
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures in Redis: %w", err)
+	}
+	return nil
+}
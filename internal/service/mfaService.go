@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/totp"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Вход с MFA проходит в два шага: после пароля выдаётся токен действия
+// mfa_pending, который вместе с кодом обменивается на пару токенов.
+// На один такой токен даётся mfaMaxAttempts попыток ввода кода; кроме того,
+// неверные коды идут в счётчики неудачных входов учётной записи и IP,
+// поэтому новые токены после повторного ввода пароля не дают перебирать дальше.
+const (
+	mfaTokenTTL          = 5 * time.Minute
+	mfaMaxAttempts       = 5
+	mfaAttemptsKeyPrefix = "mfa_attempts:"
+	defaultMFAIssuer     = "GoAuth"
+)
+
+func mfaIssuerFromEnv() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return defaultMFAIssuer
+}
+
+func totpAssociatedData(userID int) []byte {
+	return []byte("totp:" + strconv.Itoa(userID))
+}
+
+// SetupTOTP создаёт новый секрет и возвращает его вместе с otpauth-ссылкой.
+// Второй фактор начинает действовать только после ConfirmTOTP.
+func (s *AuthService) SetupTOTP(ctx context.Context, userID int) (*model.TOTPSetupResp, error) {
+	if s.secretBox == nil {
+		return nil, errs.ErrMFANotConfigured
+	}
+	existing, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, errs.ErrTOTPNotEnabled) {
+		return nil, err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return nil, errs.ErrTOTPAlreadyEnabled
+	}
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.secretBox.seal(secret, totpAssociatedData(userID))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SaveTOTP(ctx, userID, sealed); err != nil {
+		return nil, err
+	}
+	return &model.TOTPSetupResp{
+		Secret:     totp.EncodeSecret(secret),
+		OTPAuthURI: totp.URI(s.mfaIssuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает второй фактор, если код подходит к выданному секрету,
+// и выдаёт коды восстановления. Коды показываются только здесь.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID int, code string, client model.ClientInfo) ([]string, error) {
+	record, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.ConfirmedAt != nil {
+		return nil, errs.ErrTOTPAlreadyEnabled
+	}
+	secret, err := s.openTOTPSecret(record)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, errs.ErrInvalidTOTPCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	s.audit(ctx, model.AuditEvent{UserID: userID, Event: model.AuditTOTPEnabled, Client: client})
+	return codes, nil
+}
+
+// DisableTOTP отключает TOTP и, если не осталось passkey, коды восстановления;
+// нужны и пароль, и действующий код.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID int, password, code string, client model.ClientInfo) error {
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, user, password, client); err != nil {
+		return err
+	}
+	if err := s.verifyTOTP(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.DeleteTOTP(ctx, userID); err != nil {
+		return err
+	}
+	s.audit(ctx, model.AuditEvent{UserID: userID, Event: model.AuditTOTPDisabled, Client: client})
+	return nil
+}
+
+// mfaMethods возвращает подключённые вторые факторы пользователя.
+func (s *AuthService) mfaMethods(ctx context.Context, userID int) ([]string, error) {
+	var methods []string
+	record, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, errs.ErrTOTPNotEnabled) {
+		return nil, err
+	}
+	if record != nil && record.ConfirmedAt != nil {
+		methods = append(methods, model.MFAMethodTOTP)
+	}
+	hasPasskey, err := s.hasWebAuthnCredential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if hasPasskey {
+		methods = append(methods, model.MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// verifyTOTP проверяет код подключённого TOTP; каждый код принимается один раз.
+func (s *AuthService) verifyTOTP(ctx context.Context, userID int, code string) error {
+	record, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if record.ConfirmedAt == nil {
+		return errs.ErrTOTPNotEnabled
+	}
+	secret, err := s.openTOTPSecret(record)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return errs.ErrInvalidTOTPCode
+	}
+	fresh, err := s.mfaRepo.UseTOTPStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errs.ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (s *AuthService) openTOTPSecret(record *model.TOTPSecret) ([]byte, error) {
+	if s.secretBox == nil {
+		return nil, errs.ErrMFANotConfigured
+	}
+	return s.secretBox.open(record.SecretEnc, totpAssociatedData(record.UserID))
+}
+
+// startMFA выдаёт токен mfa_pending вместо пары токенов.
+func (s *AuthService) startMFA(ctx context.Context, user *model.AuthUser, methods []string) (*model.LoginResult, error) {
+	token, err := s.issueActionToken(ctx, PurposeMFA, user, mfaTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{User: user, MFAToken: token, MFAMethods: methods}, nil
+}
+
+// VerifyMFA завершает двухшаговый вход: проверяет код и гасит токен mfa_pending.
+// После mfaMaxAttempts неверных кодов токен гасится и нужно снова ввести пароль.
+// Вместо кода из приложения можно передать код восстановления.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code, recoveryCode string, client model.ClientInfo) (*model.LoginResult, error) {
+	claims, err := s.peekActionToken(ctx, mfaToken, PurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMFALock(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+	if recoveryCode != "" {
+		err = s.useRecoveryCode(ctx, claims.UserID, recoveryCode, client)
+	} else {
+		err = s.verifyTOTP(ctx, claims.UserID, code)
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrInvalidTOTPCode) || errors.Is(err, errs.ErrInvalidRecoveryCode) {
+			s.countMFAFailure(ctx, claims.ID, claims.UserID, client)
+		}
+		return nil, err
+	}
+	return s.finishMFA(ctx, claims.ID, claims.UserID, client)
+}
+
+// finishMFA гасит токен mfa_pending после принятого второго фактора и открывает
+// сессию (или выдаёт password_change_token, если пароль истёк).
+func (s *AuthService) finishMFA(ctx context.Context, jti string, userID int, client model.ClientInfo) (*model.LoginResult, error) {
+	if err := s.burnActionToken(ctx, jti); err != nil {
+		return nil, err
+	}
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.finishPasswordLogin(ctx, user, client)
+}
+
+// checkMFALock не пускает ко второму фактору, пока учётная запись заблокирована.
+func (s *AuthService) checkMFALock(ctx context.Context, userID int) error {
+	return s.checkLoginLock(ctx, loginAccountKey(userID, ""), errs.ErrAccountLocked)
+}
+
+// countMFAFailure учитывает неверный код: в попытках токена mfa_pending и
+// в счётчиках неудачных входов учётной записи и IP.
+func (s *AuthService) countMFAFailure(ctx context.Context, jti string, userID int, client model.ClientInfo) {
+	if err := s.recordLoginFailures(ctx, loginAccountKey(userID, ""), client.IP); err != nil {
+		slog.ErrorContext(ctx, "failed to count mfa failure", "user_id", userID, "error", err)
+	}
+	key := mfaAttemptsKeyPrefix + jti
+	attempts, err := s.redisService.Incr(ctx, key).Result()
+	if err != nil {
+		// без счётчика попытки не ограничены — безопаснее погасить токен
+		s.redisService.Del(ctx, actionTokenKeyPrefix+jti)
+		return
+	}
+	if attempts == 1 {
+		s.redisService.Expire(ctx, key, mfaTokenTTL)
+	}
+	if attempts >= mfaMaxAttempts {
+		s.redisService.Del(ctx, actionTokenKeyPrefix+jti)
+	}
+}
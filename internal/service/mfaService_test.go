@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/totp"
+	"testing"
+	"time"
+)
+
+// enableTOTP подключает пользователю TOTP и возвращает секрет.
+func (e *testEnv) enableTOTP(t *testing.T, userID int) []byte {
+	t.Helper()
+	ctx := context.Background()
+	setup, err := e.svc.SetupTOTP(ctx, userID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	if _, err := e.svc.ConfirmTOTP(ctx, userID, totp.Code(secret, totp.Step(time.Now())), testClient); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return secret
+}
+
+// nextTOTPCode — код следующего шага: код текущего уже погашен подтверждением.
+func nextTOTPCode(secret []byte) string {
+	return totp.Code(secret, totp.Step(time.Now())+1)
+}
+
+func (e *testEnv) mfaToken(t *testing.T, login, password string) string {
+	t.Helper()
+	result, err := e.svc.Authenticate(context.Background(), login, password, testClient)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if result.MFAToken == "" {
+		t.Fatalf("Authenticate returned no mfa token")
+	}
+	return result.MFAToken
+}
+
+func TestVerifyMFAFailuresLockAccount(t *testing.T) {
+	env := newTestService(t, map[string]string{"LOGIN_MAX_ACCOUNT_FAILURES": "3"})
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	env.enableTOTP(t, user.ID)
+
+	// верный пароль между неудачами не сбрасывает счётчик: перебор кодов
+	// через новые mfa_token упирается в ту же блокировку
+	for i := 0; i < 3; i++ {
+		token := env.mfaToken(t, "alice", "correct horse battery")
+		if _, err := env.svc.VerifyMFA(ctx, token, "000000", "", testClient); !errors.Is(err, errs.ErrInvalidTOTPCode) {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidTOTPCode", i+1, err)
+		}
+	}
+	if _, err := env.svc.Authenticate(ctx, "alice", "correct horse battery", testClient); !errors.Is(err, errs.ErrAccountLocked) {
+		t.Fatalf("Authenticate after MFA failures: got %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestVerifyMFAChecksAccountLock(t *testing.T) {
+	env := newTestService(t, map[string]string{"LOGIN_MAX_ACCOUNT_FAILURES": "2"})
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	secret := env.enableTOTP(t, user.ID)
+
+	token := env.mfaToken(t, "alice", "correct horse battery")
+	for i := 0; i < 2; i++ {
+		if _, err := env.svc.VerifyMFA(ctx, token, "000000", "", testClient); !errors.Is(err, errs.ErrInvalidTOTPCode) {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidTOTPCode", i+1, err)
+		}
+	}
+	// mfa_token ещё жив (попыток на токен больше), но учётная запись заблокирована
+	_, err := env.svc.VerifyMFA(ctx, token, nextTOTPCode(secret), "", testClient)
+	var retry *errs.RetryAfterError
+	if !errors.As(err, &retry) || !errors.Is(err, errs.ErrAccountLocked) {
+		t.Fatalf("VerifyMFA on locked account: got %v, want ErrAccountLocked with Retry-After", err)
+	}
+}
+
+func TestVerifyMFASuccessResetsFailures(t *testing.T) {
+	env := newTestService(t, map[string]string{"LOGIN_MAX_ACCOUNT_FAILURES": "3"})
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	secret := env.enableTOTP(t, user.ID)
+
+	if _, err := env.svc.Authenticate(ctx, "alice", "wrong password", testClient); !errors.Is(err, errs.ErrInvalidLoginOrPass) {
+		t.Fatalf("Authenticate with wrong password: got %v", err)
+	}
+	token := env.mfaToken(t, "alice", "correct horse battery")
+	if !env.redisExists(loginFailKeyPrefix + loginAccountKey(user.ID, "")) {
+		t.Fatal("failure counter was reset before the second factor")
+	}
+	result, err := env.svc.VerifyMFA(ctx, token, nextTOTPCode(secret), "", testClient)
+	if err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+	if result.Tokens == nil {
+		t.Fatal("VerifyMFA returned no tokens")
+	}
+	if env.redisExists(loginFailKeyPrefix + loginAccountKey(user.ID, "")) {
+		t.Fatal("failure counter survived a completed login")
+	}
+}
+
+func TestConfirmTOTPStoresRecoveryCodes(t *testing.T) {
+	env := newTestService(t, nil)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	setup, err := env.svc.SetupTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	secret, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup.Secret)
+	codes, err := env.svc.ConfirmTOTP(ctx, user.ID, totp.Code(secret, totp.Step(time.Now())), testClient)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	stored, _ := env.store.ListUnusedRecoveryCodes(ctx, user.ID)
+	if len(codes) != recoveryCodeCount || len(stored) != recoveryCodeCount {
+		t.Fatalf("got %d codes, %d stored; want %d", len(codes), len(stored), recoveryCodeCount)
+	}
+	token := env.mfaToken(t, "alice", "correct horse battery")
+	if _, err := env.svc.VerifyMFA(ctx, token, "", codes[0], testClient); err != nil {
+		t.Fatalf("VerifyMFA with a recovery code from ConfirmTOTP: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"log/slog"
+)
+
+// ChangePassword меняет пароль владельца токена после проверки текущего.
+// Все остальные сессии и все выданные токены отзываются, а вызывающий
+// получает новую пару токенов в своей сессии.
+func (s *AuthService) ChangePassword(ctx context.Context, claims *model.AuthClaims, currentPassword, newPassword string, client model.ClientInfo) (*model.TokenPair, error) {
+	user, err := s.authRepo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validatePasswordChange(ctx, user, currentPassword, newPassword, client); err != nil {
+		return nil, err
+	}
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		return nil, err
+	}
+	version, err := s.revokeAllTokens(ctx, user.ID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	user.TokenVersion = version
+	subject, err := s.tokenSubject(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if claims.SessionID == "" {
+		return s.startSession(ctx, subject, client)
+	}
+	subject.SessionID = claims.SessionID
+	return s.issueTokenPair(ctx, subject)
+}
+
+// validatePasswordChange проверяет текущий пароль, а новый — по парольной
+// политике и истории паролей.
+func (s *AuthService) validatePasswordChange(ctx context.Context, user *model.AuthUser, currentPassword, newPassword string, client model.ClientInfo) error {
+	if err := s.checkPassword(ctx, user, currentPassword, client); err != nil {
+		return err
+	}
+	if currentPassword == newPassword {
+		return errs.ErrPasswordUnchanged
+	}
+	if err := s.checkNewPassword(user, newPassword); err != nil {
+		return err
+	}
+	return s.checkPasswordHistory(ctx, user, newPassword)
+}
+
+// setPassword сохраняет новый пароль, отправляя прежний хеш в историю.
+func (s *AuthService) setPassword(ctx context.Context, userID int, password string) error {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrFailedHashPass, err)
+	}
+	if err := s.authRepo.ChangePasswordHash(ctx, userID, hashedPassword, s.keptPasswordHistory()); err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errs.ErrFailedToUpdatePassword, err)
+	}
+	return nil
+}
+
+// checkNewPassword проверяет новый пароль по парольной политике; логин, имя
+// и email пользователя в нём запрещены.
+func (s *AuthService) checkNewPassword(user *model.AuthUser, password string) error {
+	userData := []string{user.Login, user.Username}
+	if user.Email != nil {
+		userData = append(userData, *user.Email)
+	}
+	return s.passwordPolicy.Check(password, userData...)
+}
+
+// checkPassword повторно проверяет пароль уже вошедшего пользователя
+// перед чувствительными действиями. Неверный пароль считается неудачным входом,
+// а действующая блокировка входа запрещает и проверку: иначе с украденным
+// access-токеном пароль перебирался бы в обход блокировки.
+func (s *AuthService) checkPassword(ctx context.Context, user *model.AuthUser, password string, client model.ClientInfo) error {
+	if client.IP != "" {
+		if err := s.checkLoginLock(ctx, loginScopeIP+client.IP, errs.ErrTooManyAttempts); err != nil {
+			return err
+		}
+	}
+	accountKey := loginAccountKey(user.ID, "")
+	if err := s.checkLoginLock(ctx, accountKey, errs.ErrAccountLocked); err != nil {
+		return err
+	}
+	ok, err := s.hasher.Verify(user.PasswordHash, password)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrFailedToComparePassHash, err)
+	}
+	if !ok {
+		if err := s.recordLoginFailures(ctx, accountKey, client.IP); err != nil {
+			return err
+		}
+		return errs.ErrInvalidCurrentPassword
+	}
+	return nil
+}
+
+// upgradePasswordHash пересчитывает хеш только что проверенного пароля, если он
+// сделан не текущим алгоритмом или не с текущими параметрами. Ошибка не мешает
+// входу: хеш обновится при следующем.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *model.AuthUser, password string) {
+	if !s.hasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+	if err := s.authRepo.UpdatePasswordHash(ctx, user.ID, hashedPassword); err != nil {
+		slog.ErrorContext(ctx, "failed to store rehashed password", "user_id", user.ID, "error", err)
+		return
+	}
+	user.PasswordHash = hashedPassword
+}
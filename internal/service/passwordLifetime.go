@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/passpolicy"
+	"os"
+	"strconv"
+	"time"
+)
+
+// История и срок действия паролей. Прежние хеши хранятся в password_history;
+// новый пароль не может совпадать ни с одним из последних historySize паролей,
+// считая текущий. Если пароль старше maxAge, вход по паролю вместо токенов
+// возвращает password_change_token, с которым доступна только смена пароля.
+const (
+	defaultPasswordHistorySize = 5
+	passwordChangeTokenTTL     = 10 * time.Minute
+)
+
+type passwordLifetimeConfig struct {
+	historySize int
+	maxAge      time.Duration
+}
+
+// loadPasswordLifetimeConfig читает PASSWORD_HISTORY_SIZE (0 — не проверять
+// повторы) и PASSWORD_MAX_AGE_DAYS (0 — пароли не истекают).
+func loadPasswordLifetimeConfig() (passwordLifetimeConfig, error) {
+	cfg := passwordLifetimeConfig{historySize: defaultPasswordHistorySize}
+	if v := os.Getenv("PASSWORD_HISTORY_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("var PASSWORD_HISTORY_SIZE bad format: %q", v)
+		}
+		cfg.historySize = n
+	}
+	if v := os.Getenv("PASSWORD_MAX_AGE_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("var PASSWORD_MAX_AGE_DAYS bad format: %q", v)
+		}
+		cfg.maxAge = time.Duration(n) * 24 * time.Hour
+	}
+	return cfg, nil
+}
+
+func (s *AuthService) passwordExpired(user *model.AuthUser) bool {
+	return s.passwordLifetime.maxAge > 0 && time.Since(user.PasswordChangedAt) > s.passwordLifetime.maxAge
+}
+
+// keptPasswordHistory — сколько прежних хешей хранить: текущий пароль лежит в users.
+func (s *AuthService) keptPasswordHistory() int {
+	return max(s.passwordLifetime.historySize-1, 0)
+}
+
+// checkPasswordHistory отклоняет пароль, совпадающий с текущим или одним из
+// недавних, ошибкой *errs.PasswordPolicyError с правилом passpolicy.RuleHistory.
+func (s *AuthService) checkPasswordHistory(ctx context.Context, user *model.AuthUser, password string) error {
+	if s.passwordLifetime.historySize == 0 {
+		return nil
+	}
+	hashes := []string{user.PasswordHash}
+	if keep := s.keptPasswordHistory(); keep > 0 {
+		previous, err := s.authRepo.GetPasswordHistory(ctx, user.ID, keep)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, previous...)
+	}
+	for _, hash := range hashes {
+		ok, err := s.hasher.Verify(hash, password)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errs.ErrFailedToComparePassHash, err)
+		}
+		if ok {
+			return &errs.PasswordPolicyError{Violations: []errs.PasswordViolation{{
+				Rule:    passpolicy.RuleHistory,
+				Message: fmt.Sprintf("password must differ from the last %d passwords", s.passwordLifetime.historySize),
+			}}}
+		}
+	}
+	return nil
+}
+
+// finishPasswordLogin открывает сессию после проверки пароля и, если он
+// подключён, второго фактора, и сбрасывает счётчик неудачных входов.
+// Для истёкшего пароля вместо токенов выдаётся password_change_token.
+func (s *AuthService) finishPasswordLogin(ctx context.Context, user *model.AuthUser, client model.ClientInfo) (*model.LoginResult, error) {
+	if err := s.resetLoginFailures(ctx, loginAccountKey(user.ID, "")); err != nil {
+		return nil, err
+	}
+	if s.passwordExpired(user) {
+		token, err := s.issueActionToken(ctx, PurposePasswordChange, user, passwordChangeTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResult{User: user, PasswordExpired: true, PasswordChangeToken: token}, nil
+	}
+	subject, err := s.tokenSubject(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.startSession(ctx, subject, client)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// peekPasswordChangeToken проверяет password_change_token, не гася его.
+// Токен, выпущенный до "выйти везде" или смены пароля, недействителен.
+func (s *AuthService) peekPasswordChangeToken(ctx context.Context, tokenString string) (*model.ActionClaims, error) {
+	claims, err := s.peekActionToken(ctx, tokenString, PurposePasswordChange)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.currentTokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenVersion < version {
+		return nil, errs.ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+// ParsePasswordChangeToken проверяет password_change_token, не гася его, и
+// возвращает claims, достаточные для маршрута смены пароля.
+func (s *AuthService) ParsePasswordChangeToken(ctx context.Context, tokenString string) (*model.AuthClaims, error) {
+	claims, err := s.peekPasswordChangeToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthClaims{UserID: claims.UserID, TokenVersion: claims.TokenVersion, RegisteredClaims: claims.RegisteredClaims}, nil
+}
+
+// ChangeExpiredPassword меняет истёкший пароль по password_change_token: токен
+// гасится, все прежние сессии и токены отзываются, открывается новая сессия.
+// Пока токен жил, учётную запись могли деактивировать или заблокировать —
+// это проверяется так же, как при входе (блокировку проверяет checkPassword).
+func (s *AuthService) ChangeExpiredPassword(ctx context.Context, tokenString, currentPassword, newPassword string, client model.ClientInfo) (*model.TokenPair, error) {
+	claims, err := s.peekPasswordChangeToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.authRepo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActivated {
+		return nil, errs.ErrUserNotActivated
+	}
+	if err := s.validatePasswordChange(ctx, user, currentPassword, newPassword, client); err != nil {
+		return nil, err
+	}
+	if err := s.burnActionToken(ctx, claims.ID); err != nil {
+		return nil, err
+	}
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		return nil, err
+	}
+	version, err := s.revokeAllTokens(ctx, user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+	user.TokenVersion = version
+	subject, err := s.tokenSubject(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, subject, client)
+}
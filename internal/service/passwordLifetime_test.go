@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/passpolicy"
+	"testing"
+	"time"
+)
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	env := newTestService(t, map[string]string{"PASSWORD_HISTORY_SIZE": "3"})
+	user := env.addUser(t, "alice", "Correct-horse-41")
+	ctx := context.Background()
+	claims := &model.AuthClaims{UserID: user.ID}
+
+	change := func(current, next string) error {
+		_, err := env.svc.ChangePassword(ctx, claims, current, next, testClient)
+		return err
+	}
+	for _, step := range [][2]string{{"Correct-horse-41", "Correct-horse-42"}, {"Correct-horse-42", "Correct-horse-43"}} {
+		if err := change(step[0], step[1]); err != nil {
+			t.Fatalf("change %s -> %s: %v", step[0], step[1], err)
+		}
+	}
+	// текущий и два прежних пароля заняты
+	for _, old := range []string{"Correct-horse-41", "Correct-horse-42"} {
+		if rules := violatedRules(t, change("Correct-horse-43", old)); len(rules) != 1 || rules[0] != passpolicy.RuleHistory {
+			t.Fatalf("reuse of %s: violations = %v, want [%s]", old, rules, passpolicy.RuleHistory)
+		}
+	}
+	if err := change("Correct-horse-43", "Correct-horse-44"); err != nil {
+		t.Fatalf("change to a new password: %v", err)
+	}
+	// Correct-horse-41 вытеснен из истории
+	if err := change("Correct-horse-44", "Correct-horse-41"); err != nil {
+		t.Fatalf("change to a password older than the history: %v", err)
+	}
+}
+
+// expiredLogin входит пользователем с истёкшим паролем и возвращает password_change_token.
+func (e *testEnv) expiredLogin(t *testing.T, user *model.AuthUser, password string) string {
+	t.Helper()
+	e.store.updateUser(user.ID, func(u *model.AuthUser) { u.PasswordChangedAt = time.Now().Add(-31 * 24 * time.Hour) })
+	result, err := e.svc.Authenticate(context.Background(), user.Login, password, testClient)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !result.PasswordExpired || result.PasswordChangeToken == "" || result.Tokens != nil {
+		t.Fatalf("Authenticate with an expired password = %+v, want only a password change token", result)
+	}
+	return result.PasswordChangeToken
+}
+
+var passwordExpiryEnv = map[string]string{"PASSWORD_MAX_AGE_DAYS": "30"}
+
+func TestExpiredPasswordChange(t *testing.T) {
+	env := newTestService(t, passwordExpiryEnv)
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+
+	result, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient)
+	if err != nil || result.PasswordExpired || result.Tokens == nil {
+		t.Fatalf("Authenticate with a fresh password = %+v, %v; want tokens", result, err)
+	}
+
+	token := env.expiredLogin(t, user, "Correct-horse-42")
+	claims, err := env.svc.ParsePasswordChangeToken(ctx, token)
+	if err != nil || claims.UserID != user.ID {
+		t.Fatalf("ParsePasswordChangeToken = %+v, %v", claims, err)
+	}
+	if _, err := env.svc.ParseTokenAndGetClaims(token); err == nil {
+		t.Fatal("password change token accepted as an access token")
+	}
+	if _, err := env.svc.ChangeExpiredPassword(ctx, token, "Wrong-horse-42", "Battery-staple-17", testClient); !errors.Is(err, errs.ErrInvalidCurrentPassword) {
+		t.Fatalf("ChangeExpiredPassword with a wrong current password: err = %v, want ErrInvalidCurrentPassword", err)
+	}
+	tokens, err := env.svc.ChangeExpiredPassword(ctx, token, "Correct-horse-42", "Battery-staple-17", testClient)
+	if err != nil || tokens == nil {
+		t.Fatalf("ChangeExpiredPassword = %v, %v", tokens, err)
+	}
+	if _, err := env.svc.ChangeExpiredPassword(ctx, token, "Battery-staple-17", "Battery-staple-18", testClient); !errors.Is(err, errs.ErrInvalidActionToken) {
+		t.Fatalf("reused password change token: err = %v, want ErrInvalidActionToken", err)
+	}
+
+	result, err = env.svc.Authenticate(ctx, "alice", "Battery-staple-17", testClient)
+	if err != nil || result.PasswordExpired || result.Tokens == nil {
+		t.Fatalf("Authenticate after the change = %+v, %v; want tokens", result, err)
+	}
+}
+
+func TestChangeExpiredPasswordChecksAccountState(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name  string
+		after func(env *testEnv, user *model.AuthUser)
+		want  error
+	}{
+		{"deactivated", func(env *testEnv, user *model.AuthUser) {
+			env.store.updateUser(user.ID, func(u *model.AuthUser) { u.IsActivated = false })
+		}, errs.ErrUserNotActivated},
+		{"locked", func(env *testEnv, user *model.AuthUser) {
+			env.svc.redisService.Set(ctx, loginLockKeyPrefix+loginAccountKey(user.ID, ""), 1, time.Minute)
+		}, errs.ErrAccountLocked},
+		{"logged out everywhere", func(env *testEnv, user *model.AuthUser) {
+			if err := env.svc.LogoutAll(ctx, user.ID); err != nil {
+				t.Fatalf("LogoutAll: %v", err)
+			}
+		}, errs.ErrInvalidActionToken},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			env := newTestService(t, passwordExpiryEnv)
+			user := env.addUser(t, "alice", "Correct-horse-42")
+			token := env.expiredLogin(t, user, "Correct-horse-42")
+			c.after(env, user)
+
+			_, err := env.svc.ChangeExpiredPassword(ctx, token, "Correct-horse-42", "Battery-staple-17", testClient)
+			if !errors.Is(err, c.want) {
+				t.Fatalf("ChangeExpiredPassword: err = %v, want %v", err, c.want)
+			}
+			if current, _ := env.store.GetUserByID(ctx, user.ID); current.PasswordHash != user.PasswordHash {
+				t.Fatal("password changed despite the error")
+			}
+		})
+	}
+}
+
+func TestPasswordChangeTokenRevokedByLogoutAll(t *testing.T) {
+	env := newTestService(t, passwordExpiryEnv)
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	token := env.expiredLogin(t, user, "Correct-horse-42")
+	if err := env.svc.LogoutAll(context.Background(), user.ID); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	if _, err := env.svc.ParsePasswordChangeToken(context.Background(), token); !errors.Is(err, errs.ErrInvalidActionToken) {
+		t.Fatalf("ParsePasswordChangeToken after LogoutAll: err = %v, want ErrInvalidActionToken", err)
+	}
+}
+
+func TestRefreshStopsWhenPasswordExpires(t *testing.T) {
+	env := newTestService(t, passwordExpiryEnv)
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+	result, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient)
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("Authenticate = %+v, %v", result, err)
+	}
+	tokens, err := env.svc.Refresh(ctx, result.Tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh with a fresh password: %v", err)
+	}
+
+	env.store.updateUser(user.ID, func(u *model.AuthUser) { u.PasswordChangedAt = time.Now().Add(-31 * 24 * time.Hour) })
+	if _, err := env.svc.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, errs.ErrPasswordExpired) {
+		t.Fatalf("Refresh with an expired password: err = %v, want ErrPasswordExpired", err)
+	}
+	claims, err := env.svc.ParseTokenAndGetClaims(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseTokenAndGetClaims: %v", err)
+	}
+	session, err := env.store.GetSession(ctx, claims.SessionID)
+	if err != nil || session.RevokedAt == nil {
+		t.Fatalf("session after refusing to refresh = %+v, %v; want revoked", session, err)
+	}
+	if blacklisted, err := env.svc.IsTokenBlacklisted(ctx, claims, tokens.AccessToken); err != nil || !blacklisted {
+		t.Fatalf("access token of the ended session: blacklisted = %v, %v; want true", blacklisted, err)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Токен сброса пароля — случайная строка; в Redis хранится только её sha256
+// (pwreset:<хеш> -> user_id). У пользователя действует лишь последний
+// выданный токен: pwreset_user:<id> указывает на его хеш.
+const (
+	passwordResetKeyPrefix         = "pwreset:"
+	passwordResetUserKeyPrefix     = "pwreset_user:"
+	passwordResetCooldownPrefix    = "pwreset_sent:"
+	passwordResetCooldown          = time.Minute
+	defaultPasswordResetTTLMinutes = 60
+)
+
+type passwordResetConfig struct {
+	ttl     time.Duration
+	linkURL string
+}
+
+// loadPasswordResetConfig читает PASSWORD_RESET_TTL_MINUTES и PASSWORD_RESET_URL —
+// страницу фронтенда с формой нового пароля (к ней добавляется ?token=...).
+func loadPasswordResetConfig(issuer string) (passwordResetConfig, error) {
+	cfg := passwordResetConfig{ttl: defaultPasswordResetTTLMinutes * time.Minute}
+	if v := os.Getenv("PASSWORD_RESET_TTL_MINUTES"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes <= 0 {
+			return cfg, fmt.Errorf("var PASSWORD_RESET_TTL_MINUTES bad format: %q", v)
+		}
+		cfg.ttl = time.Duration(minutes) * time.Minute
+	}
+	cfg.linkURL = os.Getenv("PASSWORD_RESET_URL")
+	if cfg.linkURL == "" && issuer != "" {
+		cfg.linkURL = issuer + "/reset-password"
+	}
+	if cfg.linkURL != "" {
+		if _, err := url.Parse(cfg.linkURL); err != nil {
+			return cfg, fmt.Errorf("var PASSWORD_RESET_URL bad format: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// ForgotPassword отправляет письмо со ссылкой для сброса пароля. Для неизвестного
+// email, а также при сбоях отправки ничего не сообщает вызывающему, чтобы ответ
+// не раскрывал наличие учётной записи; сбои пишутся в лог.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string, lang string) error {
+	user, err := s.authRepo.GetUserByLoginOrEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Email == nil || *user.Email == "" {
+		return nil
+	}
+	if err := s.sendPasswordResetEmail(ctx, user.ID, user.Login, *user.Email, lang); err != nil {
+		slog.ErrorContext(ctx, "failed to send password reset email", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+func (s *AuthService) sendPasswordResetEmail(ctx context.Context, userID int, login, email, lang string) error {
+	if s.passwordReset.linkURL == "" {
+		return errors.New("var PASSWORD_RESET_URL not found (or set JWT_ISSUER)")
+	}
+	uid := strconv.Itoa(userID)
+	fresh, err := s.redisService.SetNX(ctx, passwordResetCooldownPrefix+uid, 1, passwordResetCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check reset cooldown in Redis: %w", err)
+	}
+	if !fresh {
+		return nil
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	hash := hashRefreshToken(token)
+	if previous, err := s.redisService.Get(ctx, passwordResetUserKeyPrefix+uid).Result(); err == nil {
+		s.redisService.Del(ctx, passwordResetKeyPrefix+previous)
+	}
+	if err := s.redisService.Set(ctx, passwordResetKeyPrefix+hash, userID, s.passwordReset.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store reset token in Redis: %w", err)
+	}
+	if err := s.redisService.Set(ctx, passwordResetUserKeyPrefix+uid, hash, s.passwordReset.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store reset token in Redis: %w", err)
+	}
+	link, _ := url.Parse(s.passwordReset.linkURL)
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	msg, err := mail.Render("password_reset", lang, email, map[string]interface{}{
+		"Login":      login,
+		"Link":       link.String(),
+		"TTLMinutes": int(s.passwordReset.ttl.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResetPassword гасит токен сброса, сохраняет новый пароль и отзывает все
+// токены и сессии пользователя. Пароль, не прошедший парольную политику
+// или совпавший с недавним, токен не гасит — пользователь может попробовать другой.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	hash := hashRefreshToken(token)
+	userID, err := s.redisService.Get(ctx, passwordResetKeyPrefix+hash).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return errs.ErrInvalidActionToken
+		}
+		return fmt.Errorf("failed to read reset token from Redis: %w", err)
+	}
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return errs.ErrInvalidActionToken
+		}
+		return err
+	}
+	if err := s.checkNewPassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkPasswordHistory(ctx, user, newPassword); err != nil {
+		return err
+	}
+	if err := s.redisService.GetDel(ctx, passwordResetKeyPrefix+hash).Err(); err != nil {
+		if err == redis.Nil {
+			return errs.ErrInvalidActionToken
+		}
+		return fmt.Errorf("failed to read reset token from Redis: %w", err)
+	}
+	s.redisService.Del(ctx, passwordResetUserKeyPrefix+strconv.Itoa(userID))
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			return errs.ErrInvalidActionToken
+		}
+		return err
+	}
+	return s.LogoutAll(ctx, userID)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/passpolicy"
+	"strings"
+	"testing"
+)
+
+// violatedRules возвращает правила из *errs.PasswordPolicyError или падает.
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	var policyErr *errs.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want *errs.PasswordPolicyError", err)
+	}
+	var rules []string
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestBcryptModeRejectsPasswordsOver72Bytes(t *testing.T) {
+	env := newTestService(t, map[string]string{
+		"PASSWORD_HASH_ALGORITHM": "bcrypt",
+		"BCRYPT_COST":             "4",
+	})
+	// 40 символов укладываются в PASSWORD_MAX_LENGTH, но занимают 80 байт
+	long := "Пароль-" + strings.Repeat("ж", 33)
+
+	_, _, err := env.svc.RegNewUser(context.Background(), model.AuthRegReq{
+		Login: "alice", Email: "alice@example.com", Password: long,
+	}, testClient)
+	if rules := violatedRules(t, err); len(rules) != 1 || rules[0] != passpolicy.RuleMaxLength {
+		t.Fatalf("violations = %v, want [%s]", rules, passpolicy.RuleMaxLength)
+	}
+
+	if _, _, err := env.svc.RegNewUser(context.Background(), model.AuthRegReq{
+		Login: "alice", Email: "alice@example.com", Password: long[:len(long)-10],
+	}, testClient); err != nil {
+		t.Fatalf("RegNewUser with a 70-byte password: %v", err)
+	}
+}
+
+func TestWrongCurrentPasswordCountsTowardLockout(t *testing.T) {
+	env := newTestService(t, map[string]string{"LOGIN_MAX_ACCOUNT_FAILURES": "3"})
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+	claims := &model.AuthClaims{UserID: user.ID}
+
+	for i := range 3 {
+		_, err := env.svc.ChangePassword(ctx, claims, "Wrong-horse-42", "Battery-staple-17", testClient)
+		if !errors.Is(err, errs.ErrInvalidCurrentPassword) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidCurrentPassword", i+1, err)
+		}
+	}
+	// после порога не проходит даже верный пароль — ни здесь, ни при входе
+	var retryErr *errs.RetryAfterError
+	_, err := env.svc.ChangePassword(ctx, claims, "Correct-horse-42", "Battery-staple-17", testClient)
+	if !errors.Is(err, errs.ErrAccountLocked) || !errors.As(err, &retryErr) || retryErr.RetryAfter <= 0 {
+		t.Fatalf("ChangePassword while locked: err = %v, want ErrAccountLocked with Retry-After", err)
+	}
+	if _, err := env.svc.RegenerateRecoveryCodes(ctx, user.ID, "Correct-horse-42", testClient); !errors.Is(err, errs.ErrAccountLocked) {
+		t.Fatalf("RegenerateRecoveryCodes while locked: err = %v, want ErrAccountLocked", err)
+	}
+	if _, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient); !errors.Is(err, errs.ErrAccountLocked) {
+		t.Fatalf("Authenticate while locked: err = %v, want ErrAccountLocked", err)
+	}
+	if current, _ := env.store.GetUserByID(ctx, user.ID); current.PasswordHash != user.PasswordHash {
+		t.Fatal("password changed while the account was locked")
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Коды восстановления выдаются набором при подключении TOTP, хранятся
+// bcrypt-хешами и принимаются на шаге /api/auth/mfa/verify один раз.
+const (
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+	// без похожих символов (0/o, 1/l/i), чтобы код было легко переписать с бумаги
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+func newRecoveryCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeLen; i++ {
+		if i == recoveryCodeLen/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeRecoveryCode допускает ввод без дефиса, с пробелами и в любом регистре.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// newRecoveryCodes генерирует набор кодов и их хеши для хранения.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, recoveryCodeCount)
+	hashes = make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code)), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errs.ErrFailedHashPass, err)
+		}
+		codes[i], hashes[i] = code, string(hash)
+	}
+	return codes, hashes, nil
+}
+
+func (s *AuthService) issueRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новым набором.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID int, password string, client model.ClientInfo) ([]string, error) {
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(ctx, user, password, client); err != nil {
+		return nil, err
+	}
+	methods, err := s.mfaMethods(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, errs.ErrTOTPNotEnabled
+	}
+	codes, err := s.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, model.AuditEvent{UserID: userID, Event: model.AuditRecoveryCodesRegenerated, Client: client})
+	return codes, nil
+}
+
+func (s *AuthService) useRecoveryCode(ctx context.Context, userID int, code string, client model.ClientInfo) error {
+	codes, err := s.mfaRepo.ListUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	normalized := []byte(normalizeRecoveryCode(code))
+	for _, stored := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), normalized) != nil {
+			continue
+		}
+		used, err := s.mfaRepo.UseRecoveryCode(ctx, stored.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errs.ErrInvalidRecoveryCode
+		}
+		s.audit(ctx, model.AuditEvent{
+			UserID:  userID,
+			Event:   model.AuditRecoveryCodeUsed,
+			Client:  client,
+			Details: map[string]interface{}{"code_id": stored.ID, "remaining": len(codes) - 1},
+		})
+		return nil
+	}
+	return errs.ErrInvalidRecoveryCode
+}
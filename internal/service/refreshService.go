@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Refresh-токены хранятся в Redis только в виде sha256-хеша.
+// refresh:<hash>        -> model.RefreshSession (семейство и владелец)
+// refresh_used:<hash>   -> отметка об использовании (ставится атомарно через SETNX)
+// refresh_family:<id>   -> маркер живого семейства; удаление отзывает все токены семейства
+const (
+	refreshKeyPrefix       = "refresh:"
+	refreshUsedKeyPrefix   = "refresh_used:"
+	refreshFamilyKeyPrefix = "refresh_family:"
+)
+
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createRefreshFamily заводит маркер нового семейства. Дальше он только
+// продлевается (см. storeRefreshToken), поэтому отозванное семейство не
+// воскреснет от ротации, пересёкшейся с обнаружением повтора.
+func (s *AuthService) createRefreshFamily(ctx context.Context, familyID string, userID int) error {
+	if err := s.redisService.Set(ctx, refreshFamilyKeyPrefix+familyID, userID, s.jwtService.RefreshTTL()).Err(); err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrFailedToStoreRefresh, err)
+	}
+	return nil
+}
+
+// issueTokenPair выпускает пару токенов в уже заведённом семействе subject.SessionID.
+func (s *AuthService) issueTokenPair(ctx context.Context, subject model.TokenSubject) (*model.TokenPair, error) {
+	accessToken, err := s.jwtService.GenToken(subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedGenToken, err)
+	}
+	refreshToken, err := s.storeRefreshToken(ctx, model.RefreshSession{
+		UserID:       subject.UserID,
+		FamilyID:     subject.SessionID,
+		TokenVersion: subject.TokenVersion,
+		Passkey:      subject.Passkey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.jwtService.AccessTTL().Seconds()),
+	}, nil
+}
+
+func (s *AuthService) storeRefreshToken(ctx context.Context, session model.RefreshSession) (string, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedGenRefreshToken, err)
+	}
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedToStoreRefresh, err)
+	}
+	ttl := s.jwtService.RefreshTTL()
+	alive, err := s.redisService.SetXX(ctx, refreshFamilyKeyPrefix+session.FamilyID, session.UserID, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedToStoreRefresh, err)
+	}
+	if !alive {
+		return "", errs.ErrInvalidRefreshToken
+	}
+	if err := s.redisService.Set(ctx, refreshKeyPrefix+hashRefreshToken(refreshToken), payload, ttl).Err(); err != nil {
+		return "", fmt.Errorf("%w: %w", errs.ErrFailedToStoreRefresh, err)
+	}
+	return refreshToken, nil
+}
+
+func (s *AuthService) lookupRefreshToken(ctx context.Context, refreshToken string) (*model.RefreshSession, error) {
+	raw, err := s.redisService.Get(ctx, refreshKeyPrefix+hashRefreshToken(refreshToken)).Bytes()
+	if err == redis.Nil {
+		return nil, errs.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refresh token from Redis: %w", err)
+	}
+	session := &model.RefreshSession{}
+	if err := json.Unmarshal(raw, session); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token session: %w", err)
+	}
+	return session, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару. Каждый refresh-токен одноразовый:
+// повторное предъявление уже использованного токена считается кражей
+// и отзывает всё семейство. Сессия, открытая паролем, не продлевается после
+// истечения пароля (PASSWORD_MAX_AGE_DAYS): она завершается с ErrPasswordExpired,
+// и новый вход выдаст password_change_token.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	session, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	alive, err := s.redisService.Exists(ctx, refreshFamilyKeyPrefix+session.FamilyID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check refresh token family in Redis: %w", err)
+	}
+	if alive == 0 {
+		return nil, errs.ErrInvalidRefreshToken
+	}
+	firstUse, err := s.redisService.SetNX(ctx, refreshUsedKeyPrefix+hashRefreshToken(refreshToken), 1, s.jwtService.RefreshTTL()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	if !firstUse {
+		if err := s.revokeRefreshFamily(ctx, session.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrRefreshTokenReused
+	}
+	// роль и версия берутся из БД, чтобы смена роли доходила до токенов при ближайшем обновлении
+	user, err := s.authRepo.GetUserByID(ctx, session.UserID)
+	if errors.Is(err, errs.ErrUserNotFound) {
+		return nil, errs.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.TokenVersion < user.TokenVersion {
+		if err := s.revokeRefreshFamily(ctx, session.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrInvalidRefreshToken
+	}
+	if !session.Passkey && s.passwordExpired(user) {
+		if err := s.revokeSession(ctx, session.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrPasswordExpired
+	}
+	if err := s.sessionRepo.ExtendSession(ctx, session.FamilyID, time.Now().Add(s.jwtService.RefreshTTL())); err != nil {
+		return nil, err
+	}
+	subject, err := s.tokenSubject(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	subject.SessionID = session.FamilyID
+	subject.Passkey = session.Passkey
+	return s.issueTokenPair(ctx, subject)
+}
+
+// RevokeRefreshToken отзывает семейство, к которому принадлежит refresh-токен.
+// Неизвестные и просроченные токены молча игнорируются.
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	session, err := s.lookupRefreshToken(ctx, refreshToken)
+	if errors.Is(err, errs.ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeRefreshFamily(ctx, session.FamilyID)
+}
+
+func (s *AuthService) revokeRefreshFamily(ctx context.Context, familyID string) error {
+	if err := s.redisService.Del(ctx, refreshFamilyKeyPrefix+familyID).Err(); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family in Redis: %w", err)
+	}
+	return nil
+}
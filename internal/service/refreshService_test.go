@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"friend-help/internal/errs"
+	"testing"
+	"time"
+)
+
+func TestLoadAccessTTL(t *testing.T) {
+	cases := []struct {
+		name          string
+		access, hours string
+		want          time.Duration
+		wantErr       bool
+	}{
+		{"default", "", "", 15 * time.Minute, false},
+		{"explicit", "5", "", 5 * time.Minute, false},
+		{"legacy TOKEN_TTL_HOURS ignored", "", "100", 15 * time.Minute, false},
+		{"explicit wins over legacy", "10", "100", 10 * time.Minute, false},
+		{"zero", "0", "", 0, true},
+		{"not a number", "15m", "", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("ACCESS_TOKEN_TTL_MINUTES", c.access)
+			t.Setenv("TOKEN_TTL_HOURS", c.hours)
+			got, err := loadAccessTTL()
+			if (err != nil) != c.wantErr || got != c.want {
+				t.Fatalf("loadAccessTTL = %v, %v; want %v, error %v", got, err, c.want, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	env := newTestService(t, nil)
+	env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+	result, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	first := result.Tokens
+	firstClaims, err := env.svc.ParseTokenAndGetClaims(first.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseTokenAndGetClaims: %v", err)
+	}
+	if ttl := firstClaims.ExpiresAt.Sub(firstClaims.IssuedAt.Time); ttl != 15*time.Minute || first.ExpiresIn != 900 {
+		t.Fatalf("access token lifetime = %v, expires_in = %d; want 15m and 900", ttl, first.ExpiresIn)
+	}
+
+	second, err := env.svc.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("Refresh returned the same tokens")
+	}
+	secondClaims, err := env.svc.ParseTokenAndGetClaims(second.AccessToken)
+	if err != nil || secondClaims.SessionID != firstClaims.SessionID || secondClaims.UserID != firstClaims.UserID {
+		t.Fatalf("rotated access token claims = %+v, %v; want the same session and user", secondClaims, err)
+	}
+	third, err := env.svc.Refresh(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh of the rotated token: %v", err)
+	}
+	if _, err := env.svc.Refresh(ctx, "not-a-refresh-token"); !errors.Is(err, errs.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh of an unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if third.RefreshToken == "" {
+		t.Fatal("no refresh token after the second rotation")
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	env := newTestService(t, nil)
+	env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+	login := func() (string, string) {
+		result, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		return result.Tokens.RefreshToken, result.Tokens.AccessToken
+	}
+	stolen, _ := login()
+	other, _ := login()
+
+	// законный клиент обновился, затем украденный токен предъявлен повторно
+	rotated, err := env.svc.Refresh(ctx, stolen)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := env.svc.Refresh(ctx, stolen); !errors.Is(err, errs.ErrRefreshTokenReused) {
+		t.Fatalf("replayed refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	// всё семейство отозвано, включая токен законного клиента
+	if _, err := env.svc.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, errs.ErrInvalidRefreshToken) {
+		t.Fatalf("refresh token of the revoked family: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	// другие сессии пользователя не затронуты
+	if _, err := env.svc.Refresh(ctx, other); err != nil {
+		t.Fatalf("Refresh of another session after reuse detection: %v", err)
+	}
+}
+
+func TestRefreshRejectedAfterLogoutAll(t *testing.T) {
+	env := newTestService(t, nil)
+	user := env.addUser(t, "alice", "Correct-horse-42")
+	ctx := context.Background()
+	result, err := env.svc.Authenticate(ctx, "alice", "Correct-horse-42", testClient)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if err := env.svc.LogoutAll(ctx, user.ID); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	if _, err := env.svc.Refresh(ctx, result.Tokens.RefreshToken); !errors.Is(err, errs.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh after LogoutAll: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
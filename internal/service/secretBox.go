@@ -0,0 +1,60 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"friend-help/internal/errs"
+	"os"
+)
+
+// secretBox шифрует секреты, которые приходится хранить в открытом для
+// сервиса виде (например, TOTP), ключом AES-256-GCM из MFA_ENCRYPTION_KEY.
+// Формат: nonce || ciphertext. associatedData привязывает шифротекст
+// к владельцу, чтобы его нельзя было переставить другому пользователю.
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBoxFromEnv возвращает nil без ошибки, если ключ не задан.
+func newSecretBoxFromEnv() (*secretBox, error) {
+	encoded := os.Getenv("MFA_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("var MFA_ENCRYPTION_KEY bad format: want 32 bytes in base64")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+func (b *secretBox) seal(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func (b *secretBox) open(sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, errs.ErrInvalidSecretCipher
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidSecretCipher, err)
+	}
+	return plaintext, nil
+}
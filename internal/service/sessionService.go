@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"log/slog"
+	"time"
+)
+
+// Сессия — это семейство refresh-токенов: ID сессии совпадает с ID семейства
+// и попадает в access-токены claim'ом sid.
+const (
+	sessionSeenKeyPrefix = "session_seen:"
+	sessionTouchInterval = time.Minute
+	maxUserAgentLen      = 255
+)
+
+func (s *AuthService) startSession(ctx context.Context, subject model.TokenSubject, client model.ClientInfo) (*model.TokenPair, error) {
+	sessionID, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrFailedGenRefreshToken, err)
+	}
+	session := model.Session{
+		ID:        sessionID,
+		UserID:    subject.UserID,
+		UserAgent: truncateRunes(client.UserAgent, maxUserAgentLen),
+		IP:        client.IP,
+		ExpiresAt: time.Now().Add(s.jwtService.RefreshTTL()),
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if err := s.createRefreshFamily(ctx, sessionID, subject.UserID); err != nil {
+		return nil, err
+	}
+	subject.SessionID = sessionID
+	return s.issueTokenPair(ctx, subject)
+}
+
+// truncateRunes обрезает строку до n символов, не разрезая многобайтные:
+// VARCHAR(255) в MySQL считает символы, а не байты.
+func truncateRunes(str string, n int) string {
+	count := 0
+	for i := range str {
+		if count == n {
+			return str[:i]
+		}
+		count++
+	}
+	return str
+}
+
+func (s *AuthService) ListSessions(ctx context.Context, claims *model.AuthClaims) ([]model.Session, error) {
+	sessions, err := s.sessionRepo.ListActiveSessions(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает сессию пользователя userID. Чужие и несуществующие
+// сессии неотличимы для вызывающего: обе дают ErrSessionNotFound.
+func (s *AuthService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	session, err := s.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return errs.ErrSessionNotFound
+	}
+	return s.revokeSession(ctx, sessionID)
+}
+
+// revokeSession отзывает семейство refresh-токенов и заносит sid в чёрный список,
+// чтобы уже выданные access-токены сессии перестали приниматься.
+func (s *AuthService) revokeSession(ctx context.Context, sessionID string) error {
+	if err := s.sessionRepo.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	if err := s.revokeRefreshFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	ttl := s.jwtService.AccessTTL() + s.jwtService.leeway
+	if err := s.redisService.Set(ctx, blacklistSIDPrefix+sessionID, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to blacklist session in Redis: %w", err)
+	}
+	return nil
+}
+
+// TouchSession обновляет last_seen_at не чаще раза в sessionTouchInterval.
+func (s *AuthService) TouchSession(ctx context.Context, claims *model.AuthClaims) {
+	if claims.SessionID == "" {
+		return
+	}
+	first, err := s.redisService.SetNX(ctx, sessionSeenKeyPrefix+claims.SessionID, 1, sessionTouchInterval).Result()
+	if err != nil || !first {
+		return
+	}
+	if err := s.sessionRepo.TouchSession(ctx, claims.SessionID, time.Now()); err != nil {
+		slog.Warn("failed to update session last seen time", "session_id", claims.SessionID, "error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"friend-help/internal/model"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"Mozilla/5.0", 20, "Mozilla/5.0"},
+		{"Mozilla/5.0", 7, "Mozilla"},
+		{"Яндекс.Браузер", 6, "Яндекс"},
+		{"日本語", 3, "日本語"},
+		{"日本語", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateRunes(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAuditTruncatesUserAgentOnRuneBoundary(t *testing.T) {
+	env := newTestService(t, nil)
+	ua := strings.Repeat("я", maxUserAgentLen+10)
+	env.svc.audit(context.Background(), model.AuditEvent{UserID: 1, Event: model.AuditTOTPEnabled, Client: model.ClientInfo{UserAgent: ua}})
+	got := env.store.audit[0].Client.UserAgent
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != maxUserAgentLen {
+		t.Fatalf("audit user agent: %d runes, valid UTF-8 %v; want %d valid runes", utf8.RuneCountInString(got), utf8.ValidString(got), maxUserAgentLen)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"friend-help/internal/model"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Версия токенов пользователя живёт в MySQL (users.token_version) и кешируется
+// в Redis. Увеличение версии мгновенно отзывает все ранее выданные токены.
+const (
+	tokenVersionKeyPrefix = "token_version:"
+	tokenVersionCacheTTL  = 10 * time.Minute
+)
+
+func tokenVersionKey(userID int) string {
+	return tokenVersionKeyPrefix + strconv.Itoa(userID)
+}
+
+func (s *AuthService) currentTokenVersion(ctx context.Context, userID int) (int, error) {
+	version, err := s.redisService.Get(ctx, tokenVersionKey(userID)).Int()
+	if err == nil {
+		return version, nil
+	}
+	if err != redis.Nil {
+		return 0, fmt.Errorf("failed to read token version from Redis: %w", err)
+	}
+	version, err = s.authRepo.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	// SETNX: если revokeAllTokens успел закешировать новую версию, пока мы читали
+	// MySQL, прочитанное значение устарело и не должно её перезаписать
+	stored, err := s.redisService.SetNX(ctx, tokenVersionKey(userID), version, tokenVersionCacheTTL).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to cache token version in Redis: %w", err)
+	}
+	if stored {
+		return version, nil
+	}
+	cached, err := s.redisService.Get(ctx, tokenVersionKey(userID)).Int()
+	if err == redis.Nil {
+		return version, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token version from Redis: %w", err)
+	}
+	return max(cached, version), nil
+}
+
+// IsTokenVersionCurrent сообщает, не был ли токен отозван через "выйти везде".
+func (s *AuthService) IsTokenVersionCurrent(ctx context.Context, claims *model.AuthClaims) (bool, error) {
+	version, err := s.currentTokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	return claims.TokenVersion >= version, nil
+}
+
+// LogoutAll отзывает все access- и refresh-токены пользователя.
+func (s *AuthService) LogoutAll(ctx context.Context, userID int) error {
+	_, err := s.revokeAllTokens(ctx, userID, "")
+	return err
+}
+
+// revokeAllTokens увеличивает версию токенов и завершает все сессии, кроме
+// exceptSessionID. Возвращает новую версию для токенов, выдаваемых после этого.
+func (s *AuthService) revokeAllTokens(ctx context.Context, userID int, exceptSessionID string) (int, error) {
+	version, err := s.authRepo.IncrementTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.redisService.Set(ctx, tokenVersionKey(userID), version, tokenVersionCacheTTL).Err(); err != nil {
+		return 0, fmt.Errorf("failed to cache token version in Redis: %w", err)
+	}
+	if _, err := s.sessionRepo.RevokeUserSessions(ctx, userID, exceptSessionID); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
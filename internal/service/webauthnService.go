@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Passkey (WebAuthn) работает и как второй фактор после пароля, и как
+// самостоятельный вход без пароля. Данные церемонии (challenge) живут
+// в Redis под случайным challenge_id и гасятся при первом предъявлении:
+// webauthn_challenge:<id> -> webauthnCeremony
+const (
+	webauthnChallengeKeyPrefix = "webauthn_challenge:"
+	webauthnCeremonyTTL        = 5 * time.Minute
+	webauthnHandleLen          = 32
+
+	ceremonyWebAuthnRegister = "register"
+	ceremonyWebAuthnLogin    = "login"
+	ceremonyWebAuthnMFA      = "mfa"
+)
+
+type webauthnCeremony struct {
+	Kind    string               `json:"kind"`
+	UserID  int                  `json:"user_id,omitempty"`
+	MFAJTI  string               `json:"mfa_jti,omitempty"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// newWebAuthnFromEnv читает WEBAUTHN_RP_ID, WEBAUTHN_RP_ORIGINS (через запятую)
+// и WEBAUTHN_RP_NAME. Без WEBAUTHN_RP_ID passkey отключены (возвращается nil).
+func newWebAuthnFromEnv(defaultName string) (*webauthn.WebAuthn, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		return nil, nil
+	}
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return nil, errors.New("var WEBAUTHN_RP_ORIGINS not found")
+	}
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = defaultName
+	}
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnCeremonyTTL, TimeoutUVD: webauthnCeremonyTTL}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: name,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad WebAuthn configuration: %w", err)
+	}
+	return w, nil
+}
+
+// webauthnUser связывает пользователя с интерфейсом webauthn.User.
+type webauthnUser struct {
+	user        *model.AuthUser
+	handle      []byte
+	credentials []model.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return u.handle }
+func (u *webauthnUser) WebAuthnName() string        { return u.user.Login }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.user.Username }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: c.BackupEligible, BackupState: c.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		}
+	}
+	return credentials
+}
+
+func (s *AuthService) loadWebAuthnUser(ctx context.Context, userID int) (*webauthnUser, error) {
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidate := make([]byte, webauthnHandleLen)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, err
+	}
+	handle, err := s.mfaRepo.EnsureWebAuthnHandle(ctx, userID, candidate)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.mfaRepo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthnUser{user: user, handle: handle, credentials: credentials}, nil
+}
+
+func (s *AuthService) saveWebAuthnCeremony(ctx context.Context, ceremony webauthnCeremony) (string, error) {
+	id, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(ceremony)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisService.Set(ctx, webauthnChallengeKeyPrefix+id, payload, webauthnCeremonyTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store webauthn challenge in Redis: %w", err)
+	}
+	return id, nil
+}
+
+// takeWebAuthnCeremony достаёт и гасит данные церемонии: каждый challenge
+// принимается один раз, даже если проверка ответа не прошла.
+func (s *AuthService) takeWebAuthnCeremony(ctx context.Context, id, kind string) (*webauthnCeremony, error) {
+	raw, err := s.redisService.GetDel(ctx, webauthnChallengeKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, errs.ErrInvalidWebAuthnChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webauthn challenge from Redis: %w", err)
+	}
+	ceremony := &webauthnCeremony{}
+	if err := json.Unmarshal(raw, ceremony); err != nil {
+		return nil, fmt.Errorf("failed to decode webauthn challenge: %w", err)
+	}
+	if ceremony.Kind != kind {
+		return nil, errs.ErrInvalidWebAuthnChallenge
+	}
+	return ceremony, nil
+}
+
+// webauthnError отделяет отказ в проверке ответа аутентификатора от внутренних сбоев.
+func webauthnError(err error) error {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) {
+		return fmt.Errorf("%w: %s", errs.ErrInvalidWebAuthnCredential, protocolErr.Details)
+	}
+	return err
+}
+
+// BeginWebAuthnRegistration начинает добавление passkey к учётной записи.
+func (s *AuthService) BeginWebAuthnRegistration(ctx context.Context, userID int) (*model.WebAuthnBeginResp, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	u, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := webauthn.Credentials(u.WebAuthnCredentials()).CredentialDescriptors()
+	options, session, err := s.webAuthn.BeginRegistration(u, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin webauthn registration: %w", err)
+	}
+	id, err := s.saveWebAuthnCeremony(ctx, webauthnCeremony{Kind: ceremonyWebAuthnRegister, UserID: userID, Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	return &model.WebAuthnBeginResp{ChallengeID: id, Options: options}, nil
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет passkey.
+// Если это первый второй фактор пользователя, выдаются коды восстановления.
+func (s *AuthService) FinishWebAuthnRegistration(ctx context.Context, userID int, challengeID, name string, response []byte, client model.ClientInfo) (*model.WebAuthnRegisterFinishResp, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	ceremony, err := s.takeWebAuthnCeremony(ctx, challengeID, ceremonyWebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, errs.ErrInvalidWebAuthnChallenge
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, webauthnError(err)
+	}
+	u, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.mfaMethods(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webAuthn.CreateCredential(u, ceremony.Session, parsed)
+	if err != nil {
+		return nil, webauthnError(err)
+	}
+	record := model.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+	for _, t := range credential.Transport {
+		record.Transports = append(record.Transports, string(t))
+	}
+	record.ID, err = s.mfaRepo.AddWebAuthnCredential(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, model.AuditEvent{
+		UserID:  userID,
+		Event:   model.AuditWebAuthnRegistered,
+		Client:  client,
+		Details: map[string]interface{}{"credential_id": record.ID},
+	})
+	resp := &model.WebAuthnRegisterFinishResp{Credential: record}
+	if len(methods) == 0 {
+		if resp.RecoveryCodes, err = s.issueRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *AuthService) ListWebAuthnCredentials(ctx context.Context, userID int) ([]model.WebAuthnCredential, error) {
+	return s.mfaRepo.ListWebAuthnCredentials(ctx, userID)
+}
+
+// DeleteWebAuthnCredential удаляет passkey пользователя; нужен текущий пароль.
+func (s *AuthService) DeleteWebAuthnCredential(ctx context.Context, userID, credentialID int, password string, client model.ClientInfo) error {
+	user, err := s.authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, user, password, client); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.DeleteWebAuthnCredential(ctx, userID, credentialID); err != nil {
+		return err
+	}
+	s.audit(ctx, model.AuditEvent{
+		UserID:  userID,
+		Event:   model.AuditWebAuthnRemoved,
+		Client:  client,
+		Details: map[string]interface{}{"credential_id": credentialID},
+	})
+	return nil
+}
+
+// BeginWebAuthnLogin начинает вход без пароля: пользователя определит
+// discoverable credential, выбранный в браузере. Проверка пользователя
+// (PIN, биометрия) обязательна — passkey заменяет и пароль, и второй фактор.
+func (s *AuthService) BeginWebAuthnLogin(ctx context.Context) (*model.WebAuthnBeginResp, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	options, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin webauthn login: %w", err)
+	}
+	id, err := s.saveWebAuthnCeremony(ctx, webauthnCeremony{Kind: ceremonyWebAuthnLogin, Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	return &model.WebAuthnBeginResp{ChallengeID: id, Options: options}, nil
+}
+
+// FinishWebAuthnLogin проверяет подпись passkey и открывает сессию.
+func (s *AuthService) FinishWebAuthnLogin(ctx context.Context, challengeID string, response []byte, client model.ClientInfo) (*model.LoginResult, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	ceremony, err := s.takeWebAuthnCeremony(ctx, challengeID, ceremonyWebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, webauthnError(err)
+	}
+	resolved, credential, err := s.webAuthn.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := s.mfaRepo.GetUserIDByWebAuthnHandle(ctx, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return s.loadWebAuthnUser(ctx, userID)
+	}, ceremony.Session, parsed)
+	if err != nil {
+		return nil, webauthnError(err)
+	}
+	u := resolved.(*webauthnUser)
+	if err := s.recordWebAuthnUse(ctx, u.user.ID, credential, client); err != nil {
+		return nil, err
+	}
+	if !u.user.IsActivated {
+		return nil, errs.ErrUserNotActivated
+	}
+	subject, err := s.tokenSubject(ctx, u.user)
+	if err != nil {
+		return nil, err
+	}
+	subject.Passkey = true
+	tokens, err := s.startSession(ctx, subject, client)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{User: u.user, Tokens: tokens}, nil
+}
+
+// BeginWebAuthnMFA начинает проверку passkey как второго фактора после пароля.
+func (s *AuthService) BeginWebAuthnMFA(ctx context.Context, mfaToken string) (*model.WebAuthnBeginResp, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	claims, err := s.peekActionToken(ctx, mfaToken, PurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.loadWebAuthnUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.credentials) == 0 {
+		return nil, errs.ErrWebAuthnCredentialNotFound
+	}
+	options, session, err := s.webAuthn.BeginLogin(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin webauthn login: %w", err)
+	}
+	id, err := s.saveWebAuthnCeremony(ctx, webauthnCeremony{Kind: ceremonyWebAuthnMFA, UserID: claims.UserID, MFAJTI: claims.ID, Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	return &model.WebAuthnBeginResp{ChallengeID: id, Options: options}, nil
+}
+
+// VerifyMFAWebAuthn завершает двухшаговый вход подписью passkey вместо кода.
+func (s *AuthService) VerifyMFAWebAuthn(ctx context.Context, mfaToken, challengeID string, response []byte, client model.ClientInfo) (*model.LoginResult, error) {
+	if s.webAuthn == nil {
+		return nil, errs.ErrWebAuthnNotConfigured
+	}
+	claims, err := s.peekActionToken(ctx, mfaToken, PurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMFALock(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.verifyWebAuthnMFA(ctx, claims.UserID, claims.ID, challengeID, response, client); err != nil {
+		if errors.Is(err, errs.ErrInvalidWebAuthnCredential) || errors.Is(err, errs.ErrInvalidWebAuthnChallenge) {
+			s.countMFAFailure(ctx, claims.ID, claims.UserID, client)
+		}
+		return nil, err
+	}
+	return s.finishMFA(ctx, claims.ID, claims.UserID, client)
+}
+
+func (s *AuthService) verifyWebAuthnMFA(ctx context.Context, userID int, jti, challengeID string, response []byte, client model.ClientInfo) error {
+	ceremony, err := s.takeWebAuthnCeremony(ctx, challengeID, ceremonyWebAuthnMFA)
+	if err != nil {
+		return err
+	}
+	if ceremony.UserID != userID || ceremony.MFAJTI != jti {
+		return errs.ErrInvalidWebAuthnChallenge
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return webauthnError(err)
+	}
+	u, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	credential, err := s.webAuthn.ValidateLogin(u, ceremony.Session, parsed)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return s.recordWebAuthnUse(ctx, userID, credential, client)
+}
+
+// recordWebAuthnUse сохраняет новый счётчик подписей. Счётчик, не выросший
+// с прошлого входа, означает возможный клон ключа: вход отклоняется.
+func (s *AuthService) recordWebAuthnUse(ctx context.Context, userID int, credential *webauthn.Credential, client model.ClientInfo) error {
+	if credential.Authenticator.CloneWarning {
+		slog.WarnContext(ctx, "webauthn sign counter did not increase, possible cloned authenticator", "user_id", userID)
+		s.audit(ctx, model.AuditEvent{
+			UserID:  userID,
+			Event:   model.AuditWebAuthnCloneWarning,
+			Client:  client,
+			Details: map[string]interface{}{"sign_count": credential.Authenticator.SignCount},
+		})
+		return fmt.Errorf("%w: sign counter did not increase", errs.ErrInvalidWebAuthnCredential)
+	}
+	return s.mfaRepo.UpdateWebAuthnCredentialUsage(ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+}
+
+// hasWebAuthnCredential нужен mfaMethods: подключённый passkey включает второй фактор.
+func (s *AuthService) hasWebAuthnCredential(ctx context.Context, userID int) (bool, error) {
+	credentials, err := s.mfaRepo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	testRPID   = "auth.example.com"
+	testOrigin = "https://auth.example.com"
+)
+
+var webauthnTestEnv = map[string]string{
+	"WEBAUTHN_RP_ID":      testRPID,
+	"WEBAUTHN_RP_ORIGINS": testOrigin,
+}
+
+// softAuthenticator — программный аутентификатор с ключом ES256, который
+// отвечает на церемонии так же, как браузер с платформенным passkey.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+var b64 = base64.RawURLEncoding
+
+// publicKeyOptions достаёт из параметров церемонии то, что браузер передал
+// бы аутентификатору: challenge и, при регистрации, user handle.
+func publicKeyOptions(t *testing.T, options interface{}) (challenge string, userHandle []byte) {
+	t.Helper()
+	raw, err := json.Marshal(options)
+	if err != nil {
+		t.Fatalf("marshal options: %v", err)
+	}
+	var parsed struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		t.Fatalf("unmarshal options: %v", err)
+	}
+	if parsed.PublicKey.User.ID != "" {
+		if userHandle, err = b64.DecodeString(parsed.PublicKey.User.ID); err != nil {
+			t.Fatalf("decode user handle: %v", err)
+		}
+	}
+	return parsed.PublicKey.Challenge, userHandle
+}
+
+func clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      testOrigin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// authData собирает authenticator data: хеш RP ID, флаги UP и UV, счётчик
+// и, если передан, attested credential data.
+func (a *softAuthenticator) authData(attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified
+	if attested != nil {
+		flags |= protocol.FlagAttestedCredentialData
+	}
+	data := append(rpHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// register отвечает на navigator.credentials.create аттестацией "none".
+func (a *softAuthenticator) register(t *testing.T, options interface{}) []byte {
+	t.Helper()
+	challenge, userHandle := publicKeyOptions(t, options)
+	a.userHandle = userHandle
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	raw := point.Bytes() // 0x04 || X || Y
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: raw[1:33],
+		YCoord: raw[33:],
+	})
+	if err != nil {
+		t.Fatalf("marshal COSE key: %v", err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(attested),
+	})
+	if err != nil {
+		t.Fatalf("marshal attestation object: %v", err)
+	}
+	return a.credentialJSON(t, map[string]interface{}{
+		"clientDataJSON":    b64.EncodeToString(clientData("webauthn.create", challenge)),
+		"attestationObject": b64.EncodeToString(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// assert отвечает на navigator.credentials.get подписью с увеличенным счётчиком.
+func (a *softAuthenticator) assert(t *testing.T, options interface{}) []byte {
+	t.Helper()
+	challenge, _ := publicKeyOptions(t, options)
+	a.signCount++
+	authData := a.authData(nil)
+	clientDataJSON := clientData("webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+	return a.credentialJSON(t, map[string]interface{}{
+		"clientDataJSON":    b64.EncodeToString(clientDataJSON),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credentialJSON(t *testing.T, response map[string]interface{}) []byte {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{
+		"id":                      b64.EncodeToString(a.credentialID),
+		"rawId":                   b64.EncodeToString(a.credentialID),
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]interface{}{},
+		"response":                response,
+	})
+	if err != nil {
+		t.Fatalf("marshal credential: %v", err)
+	}
+	return body
+}
+
+// registerPasskey проводит регистрацию passkey от начала до конца.
+func (e *testEnv) registerPasskey(t *testing.T, userID int, a *softAuthenticator) *model.WebAuthnRegisterFinishResp {
+	t.Helper()
+	ctx := context.Background()
+	begin, err := e.svc.BeginWebAuthnRegistration(ctx, userID)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration: %v", err)
+	}
+	resp, err := e.svc.FinishWebAuthnRegistration(ctx, userID, begin.ChallengeID, "laptop", a.register(t, begin.Options), testClient)
+	if err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+	return resp
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	env := newTestService(t, webauthnTestEnv)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	a := newSoftAuthenticator(t)
+
+	resp := env.registerPasskey(t, user.ID, a)
+	if resp.Credential.Name != "laptop" || len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("first passkey: name %q, %d recovery codes; want laptop and %d codes", resp.Credential.Name, len(resp.RecoveryCodes), recoveryCodeCount)
+	}
+	credentials, _ := env.svc.ListWebAuthnCredentials(ctx, user.ID)
+	if len(credentials) != 1 || string(credentials[0].CredentialID) != string(a.credentialID) {
+		t.Fatalf("stored credentials: %+v", credentials)
+	}
+	methods, _ := env.svc.mfaMethods(ctx, user.ID)
+	if len(methods) != 1 || methods[0] != model.MFAMethodWebAuthn {
+		t.Fatalf("mfa methods after registration: %v", methods)
+	}
+
+	// тот же ключ повторно не регистрируется
+	begin, err := env.svc.BeginWebAuthnRegistration(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration: %v", err)
+	}
+	if _, err := env.svc.FinishWebAuthnRegistration(ctx, user.ID, begin.ChallengeID, "again", a.register(t, begin.Options), testClient); !errors.Is(err, errs.ErrWebAuthnCredentialExists) {
+		t.Fatalf("duplicate registration: got %v, want ErrWebAuthnCredentialExists", err)
+	}
+}
+
+func TestVerifyMFAWebAuthn(t *testing.T) {
+	env := newTestService(t, webauthnTestEnv)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	a := newSoftAuthenticator(t)
+	env.registerPasskey(t, user.ID, a)
+
+	token := env.mfaToken(t, "alice", "correct horse battery")
+	begin, err := env.svc.BeginWebAuthnMFA(ctx, token)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnMFA: %v", err)
+	}
+	assertion := a.assert(t, begin.Options)
+	result, err := env.svc.VerifyMFAWebAuthn(ctx, token, begin.ChallengeID, assertion, testClient)
+	if err != nil {
+		t.Fatalf("VerifyMFAWebAuthn: %v", err)
+	}
+	if result.Tokens == nil || result.User.ID != user.ID {
+		t.Fatalf("VerifyMFAWebAuthn result: %+v", result)
+	}
+	credentials, _ := env.store.ListWebAuthnCredentials(ctx, user.ID)
+	if credentials[0].SignCount != a.signCount || credentials[0].LastUsedAt == nil {
+		t.Fatalf("credential usage not recorded: sign count %d, want %d", credentials[0].SignCount, a.signCount)
+	}
+
+	// mfa_token погашен, challenge одноразовый
+	if _, err := env.svc.VerifyMFAWebAuthn(ctx, token, begin.ChallengeID, assertion, testClient); !errors.Is(err, errs.ErrInvalidActionToken) {
+		t.Fatalf("reused mfa token: got %v, want ErrInvalidActionToken", err)
+	}
+}
+
+func TestVerifyMFAWebAuthnRejectsBadAssertions(t *testing.T) {
+	env := newTestService(t, webauthnTestEnv)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	a := newSoftAuthenticator(t)
+	env.registerPasskey(t, user.ID, a)
+	token := env.mfaToken(t, "alice", "correct horse battery")
+
+	// подпись чужим ключом с тем же credential ID
+	begin, _ := env.svc.BeginWebAuthnMFA(ctx, token)
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID, impostor.userHandle = a.credentialID, a.userHandle
+	if _, err := env.svc.VerifyMFAWebAuthn(ctx, token, begin.ChallengeID, impostor.assert(t, begin.Options), testClient); !errors.Is(err, errs.ErrInvalidWebAuthnCredential) {
+		t.Fatalf("foreign signature: got %v, want ErrInvalidWebAuthnCredential", err)
+	}
+	// challenge гасится и после неудачной проверки
+	if _, err := env.svc.VerifyMFAWebAuthn(ctx, token, begin.ChallengeID, a.assert(t, begin.Options), testClient); !errors.Is(err, errs.ErrInvalidWebAuthnChallenge) {
+		t.Fatalf("reused challenge: got %v, want ErrInvalidWebAuthnChallenge", err)
+	}
+	// счётчик подписей меньше сохранённого — возможный клон
+	env.store.UpdateWebAuthnCredentialUsage(ctx, a.credentialID, 5, false)
+	a.signCount = 2
+	begin, _ = env.svc.BeginWebAuthnMFA(ctx, token)
+	if _, err := env.svc.VerifyMFAWebAuthn(ctx, token, begin.ChallengeID, a.assert(t, begin.Options), testClient); !errors.Is(err, errs.ErrInvalidWebAuthnCredential) {
+		t.Fatalf("stale sign counter: got %v, want ErrInvalidWebAuthnCredential", err)
+	}
+}
+
+func TestFinishWebAuthnLogin(t *testing.T) {
+	env := newTestService(t, webauthnTestEnv)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	a := newSoftAuthenticator(t)
+	env.registerPasskey(t, user.ID, a)
+
+	begin, err := env.svc.BeginWebAuthnLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	result, err := env.svc.FinishWebAuthnLogin(ctx, begin.ChallengeID, a.assert(t, begin.Options), testClient)
+	if err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+	if result.Tokens == nil || result.User.ID != user.ID {
+		t.Fatalf("FinishWebAuthnLogin result: %+v", result)
+	}
+	if _, err := env.svc.jwtService.ParseTokenAndGetClaims(result.Tokens.AccessToken); err != nil {
+		t.Fatalf("issued access token does not parse: %v", err)
+	}
+
+	// срок пароля сессию по passkey не ограничивает
+	env.svc.passwordLifetime.maxAge = 30 * 24 * time.Hour
+	env.store.updateUser(user.ID, func(u *model.AuthUser) { u.PasswordChangedAt = time.Now().Add(-31 * 24 * time.Hour) })
+	tokens, err := env.svc.Refresh(ctx, result.Tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh of a passkey session with an expired password: %v", err)
+	}
+	if _, err := env.svc.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("second Refresh of a passkey session: %v", err)
+	}
+
+	// неизвестный passkey не входит
+	begin, _ = env.svc.BeginWebAuthnLogin(ctx)
+	stranger := newSoftAuthenticator(t)
+	stranger.userHandle = []byte("no-such-user-handle")
+	if _, err := env.svc.FinishWebAuthnLogin(ctx, begin.ChallengeID, stranger.assert(t, begin.Options), testClient); err == nil {
+		t.Fatal("FinishWebAuthnLogin accepted an unregistered passkey")
+	}
+}
+
+func TestDisableTOTPKeepsRecoveryCodesWhilePasskeyRemains(t *testing.T) {
+	env := newTestService(t, webauthnTestEnv)
+	ctx := context.Background()
+	user := env.addUser(t, "alice", "correct horse battery")
+	secret := env.enableTOTP(t, user.ID)
+	a := newSoftAuthenticator(t)
+	env.registerPasskey(t, user.ID, a)
+
+	if err := env.svc.DisableTOTP(ctx, user.ID, "correct horse battery", nextTOTPCode(secret), testClient); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	codes, _ := env.store.ListUnusedRecoveryCodes(ctx, user.ID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("recovery codes after disabling TOTP with a passkey left: %d, want %d", len(codes), recoveryCodeCount)
+	}
+	credentials, _ := env.store.ListWebAuthnCredentials(ctx, user.ID)
+	if err := env.svc.DeleteWebAuthnCredential(ctx, user.ID, credentials[0].ID, "correct horse battery", testClient); err != nil {
+		t.Fatalf("DeleteWebAuthnCredential: %v", err)
+	}
+	if codes, _ := env.store.ListUnusedRecoveryCodes(ctx, user.ID); len(codes) != 0 {
+		t.Fatalf("recovery codes after removing the last second factor: %d, want 0", len(codes))
+	}
+}
@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет из приложений RFC 4226 и RFC 6238 (режим SHA1).
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC4226(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := Code(rfcSecret, int64(counter)); got != code {
+			t.Errorf("Code(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// В RFC 6238 коды восьмизначные; шестизначный код — их последние 6 цифр.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		want := tt.want[len(tt.want)-Digits:]
+		if got := Code(rfcSecret, Step(time.Unix(tt.unix, 0))); got != want {
+			t.Errorf("T=%d: code %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	for _, delta := range []int64{-1, 0, 1} {
+		step, ok := Validate(rfcSecret, Code(rfcSecret, current+delta), now)
+		if !ok || step != current+delta {
+			t.Errorf("delta %d: got (%d, %v), want (%d, true)", delta, step, ok, current+delta)
+		}
+	}
+	for _, code := range []string{Code(rfcSecret, current-2), Code(rfcSecret, current+2), "", "12345", "1234567"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate(%q) accepted a code outside the window", code)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Go Auth", "alice", rfcSecret)
+	for _, part := range []string{"otpauth://totp/Go%20Auth:alice?", "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "issuer=Go%20Auth", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("URI %q does not contain %q", uri, part)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Назначить роль пользователю
+// @Description  Меняет роль пользователя (member, moderator, admin). Доступно администраторам с правом roles:assign; если задан POLICY_FILE, действие admin:roles.assign проверяется ещё и политиками. Новая роль попадает в токены при ближайшем обновлении или входе.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int              true "ID пользователя"
+// @Param        input body  model.SetRoleReq true "Новая роль"
+// @Success      200 {object} map[string]interface{} "Роль изменена"
+// @Failure      400 {object} map[string]interface{} "Некорректный ID или роль"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      403 {object} map[string]interface{} "Недостаточно прав (роль, право roles:assign или политика admin:roles.assign)"
+// @Failure      404 {object} map[string]interface{} "Пользователь не найден"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД)"
+// @Router       /admin/users/{id}/role [put]
+func (h *HTTPHandlers) HandlerSetUserRole(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	var req model.SetRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	err = h.AuthService.SetUserRole(c.Request.Context(), userID, req.Role)
+	if err != nil {
+		if errors.Is(err, errs.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "role": req.Role})
+}
@@ -0,0 +1,88 @@
+package https
+
+import (
+	"context"
+	"encoding/json"
+	"friend-help/internal/model"
+	"friend-help/internal/policy"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthzRouter отдаёт /authz/check с claims в контексте вместо AuthMiddleware.
+func newAuthzRouter(t *testing.T, claims *model.AuthClaims) *gin.Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	content := `
+policies:
+  - id: office
+    effect: allow
+    actions: ["documents:read"]
+    conditions:
+      - {attr: request.ip, op: cidr, value: ["10.0.0.0/8"]}
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write policies: %v", err)
+	}
+	t.Setenv("POLICY_FILE", path)
+	engine, err := policy.NewEngineFromEnv()
+	if err != nil {
+		t.Fatalf("NewEngineFromEnv: %v", err)
+	}
+	h := &HTTPHandlers{Policy: engine}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/authz/check", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), UserCtxKey, claims))
+		c.Next()
+	}, h.HandlerAuthzCheck)
+	return router
+}
+
+func authzCheck(t *testing.T, router *gin.Engine, remoteAddr, body string) model.AuthzCheckResp {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/authz/check", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp model.AuthzCheckResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
+
+func TestAuthzCheckRequestIP(t *testing.T) {
+	const userIP = `{"action": "documents:read", "request": {"ip": "10.1.2.3"}}`
+	cases := []struct {
+		name       string
+		scope      string
+		remoteAddr string
+		body       string
+		allowed    bool
+	}{
+		{"caller address is used", "", "10.0.0.5:4000", `{"action": "documents:read"}`, true},
+		{"ip from body ignored without permission", "profile:read", "203.0.113.7:4000", userIP, false},
+		{"ip from body cannot hide caller address", "profile:read", "10.0.0.5:4000", `{"action": "documents:read", "request": {"ip": "203.0.113.7"}}`, true},
+		{"service with authz:check passes user ip", "authz:check", "203.0.113.7:4000", userIP, true},
+		{"service with authz:check and bad ip", "authz:check", "203.0.113.7:4000", `{"action": "documents:read", "request": {"ip": "10.0.0.0/8"}}`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newAuthzRouter(t, &model.AuthClaims{UserID: 1, Role: model.Member, Scope: tc.scope})
+			if got := authzCheck(t, router, tc.remoteAddr, tc.body); got.Allowed != tc.allowed {
+				t.Fatalf("Allowed = %v, want %v", got.Allowed, tc.allowed)
+			}
+		})
+	}
+}
@@ -1,15 +1,24 @@
-package https
-
-import (
-	"context"
-	"friend-help/internal/model"
-)
-
-type contextKey string
-
-const UserCtxKey contextKey = "user_claims"
-
-func GetUserFromContext(ctx context.Context) (*model.AuthClaims, bool) {
-	claims, ok := ctx.Value(UserCtxKey).(*model.AuthClaims)
-	return claims, ok
-}
+package https
+
+import (
+	"context"
+	"friend-help/internal/model"
+)
+
+type contextKey string
+
+const UserCtxKey contextKey = "user_claims"
+
+// PasswordChangeTokenCtxKey — password_change_token, которым прошёл запрос
+// на смену истёкшего пароля (см. PasswordChangeAuth).
+const PasswordChangeTokenCtxKey contextKey = "password_change_token"
+
+func GetUserFromContext(ctx context.Context) (*model.AuthClaims, bool) {
+	claims, ok := ctx.Value(UserCtxKey).(*model.AuthClaims)
+	return claims, ok
+}
+
+func GetPasswordChangeTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(PasswordChangeTokenCtxKey).(string)
+	return token, ok
+}
@@ -1,148 +1,322 @@
-package https
-
-import (
-	"errors"
-	"friend-help/internal/errs"
-	"friend-help/internal/model"
-	"friend-help/internal/service"
-	"net/http"
-	"strings"
-
-	"github.com/gin-gonic/gin"
-)
-
-type HTTPHandlers struct {
-	AuthService *service.AuthService
-}
-
-func NewHTTPHandlers(AuthService *service.AuthService) *HTTPHandlers {
-	return &HTTPHandlers{
-		AuthService: AuthService,
-	}
-}
-
-// @Summary      Регистрация нового пользователя
-// @Description  Создает нового пользователя, хеширует пароль, сохраняет в БД и выдает JWT-токен.
-// @Tags         auth
-// @Accept       json
-// @Produce      json
-// @Param        input body model.AuthRegReq true "Данные для регистрации (login, email, password)"
-// @Success      201  {object}  map[string]interface{} "Успешное создание ресурса и выдан токен"
-// @Failure      400  {object}  map[string]interface{} "Некорректный JSON, невалидные поля (min length, email format)"
-// @Failure      409  {object}  map[string]interface{} "Пользователь с таким логином или email уже существует (errs.ErrUserExists)"
-// @Failure      500  {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, хеширования пароля, генерации токена)"
-// @Router       /auth/reg [post]
-func (h *HTTPHandlers) HandlerReg(c *gin.Context) {
-	var req model.AuthRegReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
-		return
-	}
-	userID, token, err := h.AuthService.RegNewUser(c.Request.Context(), req)
-	if err != nil {
-		if errors.Is(err, errs.ErrUserExists) {
-			c.JSON(http.StatusConflict, gin.H{"error": "user already registered"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, gin.H{
-		"user_id": userID,
-		"token":   token,
-		"message": "Registration successful",
-	})
-}
-
-// @Summary      Вход пользователя
-// @Description  Аутентифицирует пользователя по логину/email и паролю, выдает новый JWT-токен.
-// @Tags         auth
-// @Accept       json
-// @Produce      json
-// @Param        input body model.AuthLogReq true "Данные для входа (identifier: login/email, password)"
-// @Success      200  {object}  map[string]interface{} "Успешный вход и выдан токен"
-// @Failure      400  {object}  map[string]interface{} "Некорректный JSON или невалидные символы в идентификаторе"
-// @Failure      401  {object}  map[string]interface{} "Неверный логин/email или пароль"
-// @Failure      500  {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, сравнения хеша, генерации токена)"
-// @Router       /auth/login [post]
-func (h *HTTPHandlers) HandlerLogin(c *gin.Context) {
-	var req model.AuthLogReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
-		return
-	}
-	user, token, err := h.AuthService.Authenticate(c.Request.Context(), req.Identifier, req.Password)
-	if err != nil {
-		if errors.Is(err, errs.ErrInvalidLoginOrPass) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid login or password"})
-			return
-		}
-		if errors.Is(err, errs.ErrUserNotFound) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid login or password"})
-			return
-		}
-		if errors.Is(err, errs.ErrInvalidLoginChars) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process login"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"user_id": user.ID,
-		"token":   token,
-		"message": "Login successful",
-	})
-}
-
-// @Summary      Выход из системы
-// @Description  Добавляет переданный JWT-токен в чёрный список до истечения его срока действия. Токен должен быть передан в заголовке Authorization как Bearer-токен.
-// @Tags         auth
-// @Accept       json
-// @Produce      json
-// @Security     BearerAuth
-// @Success      200  {object}  map[string]interface{}  "Успешный выход из системы"
-// @Failure      401  {object}  map[string]interface{}  "Отсутствует или неверный заголовок Authorization"
-// @Failure      500  {object}  map[string]interface{}  "Внутренняя ошибка сервера (ошибка взаимодействия с Redis)"
-// @Router       /auth/logout [post]
-func (h *HTTPHandlers) HandlerLogout(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
-		return
-	}
-	tokenString := ""
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		tokenString = authHeader[7:]
-	} else {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header format"})
-		return
-	}
-	err := h.AuthService.Logout(c.Request.Context(), tokenString)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "logout failed"})
-		return
-	}
-	c.JSON(200, gin.H{"message": "logged out"})
-}
-
-// @Summary      Получить профиль пользователя (бета покачто)
-// @Description  Возвращает информацию о текущем авторизованном пользователе (из JWT claims)
-// @Tags         user
-// @Accept       json
-// @Produce      json
-// @Security     BearerAuth
-// @Success      200 {object} map[string]interface{} "Данные профиля"
-// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
-// @Router       /user/profile [get]
-func (h *HTTPHandlers) HandlerGetProfile(c *gin.Context) {
-	claims, ok := GetUserFromContext(c.Request.Context())
-	if !ok {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"user_id": claims.UserID,
-		"role":    claims.Role,
-	})
-}
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/mail"
+	"friend-help/internal/model"
+	"friend-help/internal/policy"
+	"friend-help/internal/ratelimit"
+	"friend-help/internal/service"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HTTPHandlers struct {
+	AuthService *service.AuthService
+	Policy      *policy.Engine
+	Limiter     ratelimit.Limiter
+	RateLimits  ratelimit.Rules
+}
+
+func NewHTTPHandlers(AuthService *service.AuthService, Policy *policy.Engine, Limiter ratelimit.Limiter, RateLimits ratelimit.Rules) *HTTPHandlers {
+	return &HTTPHandlers{
+		AuthService: AuthService,
+		Policy:      Policy,
+		Limiter:     Limiter,
+		RateLimits:  RateLimits,
+	}
+}
+
+// clientInfo собирает данные клиента для сессий и блокировок входа. IP —
+// c.ClientIP(): X-Forwarded-For берётся только от прокси из TRUSTED_PROXIES,
+// иначе клиент мог бы менять адрес и обходить LOGIN_MAX_IP_FAILURES.
+func clientInfo(c *gin.Context) model.ClientInfo {
+	return model.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		Language:  mail.MatchLanguage(c.GetHeader("Accept-Language")),
+	}
+}
+
+// @Summary      Регистрация нового пользователя
+// @Description  Создает нового пользователя, хеширует пароль, сохраняет в БД и выдает пару токенов (короткоживущий JWT и refresh-токен). Если включено подтверждение email (REQUIRE_EMAIL_VERIFICATION), email обязателен, токены не выдаются, а на почту уходит ссылка для активации.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.AuthRegReq true "Данные для регистрации (login, email, password)"
+// @Success      201  {object}  map[string]interface{} "Успешное создание ресурса и выдан токен"
+// @Success      202  {object}  map[string]interface{} "Режим REGISTRATION_ENUMERATION_SAFE: заявка принята, дальнейшее — в письме (ответ одинаков для новых и занятых логина/email)"
+// @Failure      400  {object}  map[string]interface{} "Некорректный JSON, невалидные поля (длина логина, формат email), не указан обязательный email или пароль нарушает парольную политику (список нарушений в violations)"
+// @Failure      409  {object}  map[string]interface{} "Пользователь с таким логином или email уже существует (errs.ErrUserExists); в режиме REGISTRATION_ENUMERATION_SAFE не возвращается"
+// @Failure      500  {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, хеширования пароля, генерации токена)"
+// @Router       /auth/reg [post]
+func (h *HTTPHandlers) HandlerReg(c *gin.Context) {
+	var req model.AuthRegReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	userID, tokens, err := h.AuthService.RegNewUser(c.Request.Context(), req, clientInfo(c))
+	if err == nil && h.AuthService.EnumerationSafeRegistration() {
+		c.JSON(http.StatusAccepted, gin.H{
+			"verification_required": true,
+			"message":               "If the registration can be completed, an email with further instructions has been sent",
+		})
+		return
+	}
+	if err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrUserExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "user already registered"})
+			return
+		}
+		if errors.Is(err, errs.ErrEmailRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tokens == nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"user_id":               userID,
+			"verification_required": true,
+			"message":               "Registration successful, check your email to activate the account",
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"user_id":       userID,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"message":       "Registration successful",
+	})
+}
+
+// @Summary      Вход пользователя
+// @Description  Аутентифицирует пользователя по логину/email и паролю, выдает новую пару токенов (JWT и refresh-токен). Если подключён второй фактор, вместо токенов возвращается mfa_required=true и короткоживущий mfa_token для /api/auth/mfa/verify. Если пароль старше PASSWORD_MAX_AGE_DAYS, вместо токенов возвращается password_expired=true и password_change_token, с которым доступна только смена пароля (POST /api/user/password).
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.AuthLogReq true "Данные для входа (identifier: login/email, password)"
+// @Success      200  {object}  map[string]interface{} "Успешный вход и выдан токен (или требуется второй фактор)"
+// @Failure      400  {object}  map[string]interface{} "Некорректный JSON или невалидные символы в идентификаторе"
+// @Failure      401  {object}  map[string]interface{} "Неверный логин/email или пароль"
+// @Failure      403  {object}  map[string]interface{} "Email не подтверждён (errs.ErrUserNotActivated)"
+// @Failure      423  {object}  map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток; см. Retry-After"
+// @Failure      429  {object}  map[string]interface{} "Слишком много неудачных попыток с этого IP; см. Retry-After"
+// @Failure      500  {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, сравнения хеша, генерации токена)"
+// @Router       /auth/login [post]
+func (h *HTTPHandlers) HandlerLogin(c *gin.Context) {
+	var req model.AuthLogReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	result, err := h.AuthService.Authenticate(c.Request.Context(), req.Identifier, req.Password, clientInfo(c))
+	if err != nil {
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidLoginOrPass) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid login or password"})
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid login or password"})
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidLoginChars) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotActivated) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process login"})
+		return
+	}
+	respondLogin(c, result)
+}
+
+// respondRetryAfter отвечает 423 (заблокирована учётная запись) или 429
+// (слишком много неудач с этого IP) с заголовком Retry-After.
+func respondRetryAfter(c *gin.Context, err error) bool {
+	var retryErr *errs.RetryAfterError
+	if !errors.As(err, &retryErr) {
+		return false
+	}
+	status := http.StatusTooManyRequests
+	if errors.Is(err, errs.ErrAccountLocked) {
+		status = http.StatusLocked
+	}
+	seconds := int(math.Ceil(retryErr.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(status, gin.H{"error": err.Error(), "retry_after": seconds})
+	return true
+}
+
+// respondLogin отдаёт пару токенов либо, если нужен второй фактор, mfa_token,
+// либо, если пароль истёк, password_change_token.
+func respondLogin(c *gin.Context, result *model.LoginResult) {
+	if result.PasswordExpired {
+		c.JSON(http.StatusOK, gin.H{
+			"password_expired":      true,
+			"password_change_token": result.PasswordChangeToken,
+			"message":               "Password expired, change it via POST /api/user/password with the password_change_token as Bearer token",
+		})
+		return
+	}
+	if result.Tokens == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"mfa_methods":  result.MFAMethods,
+			"message":      "Second factor required",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":       result.User.ID,
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
+		"message":       "Login successful",
+	})
+}
+
+// @Summary      Обновление токенов
+// @Description  Обменивает refresh-токен на новую пару токенов. Каждый refresh-токен одноразовый: повторное использование отзывает всё семейство токенов этой сессии.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.RefreshReq true "Refresh-токен, выданный при входе, регистрации или прошлом обновлении"
+// @Success      200  {object}  model.TokenPair "Новая пара токенов"
+// @Failure      400  {object}  map[string]interface{} "Некорректный JSON или отсутствует refresh_token"
+// @Failure      401  {object}  map[string]interface{} "Refresh-токен недействителен, истёк или уже был использован; либо истёк пароль (password_expired: true) — сессия завершена, нужен новый вход"
+// @Failure      500  {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка Redis, генерации токена)"
+// @Router       /auth/refresh [post]
+func (h *HTTPHandlers) HandlerRefresh(c *gin.Context) {
+	var req model.RefreshReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	tokens, err := h.AuthService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, errs.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected, session revoked"})
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+			return
+		}
+		if errors.Is(err, errs.ErrPasswordExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "password_expired": true})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary      Выход из системы
+// @Description  Добавляет переданный JWT-токен в чёрный список до истечения его срока действия и завершает его сессию. Токен должен быть передан в заголовке Authorization как Bearer-токен. Если в теле передан refresh_token, отзывается и его семейство.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.LogoutReq false "Необязательный refresh-токен текущей сессии"
+// @Success      200  {object}  map[string]interface{}  "Успешный выход из системы"
+// @Failure      401  {object}  map[string]interface{}  "Отсутствует или неверный заголовок Authorization"
+// @Failure      500  {object}  map[string]interface{}  "Внутренняя ошибка сервера (ошибка взаимодействия с Redis)"
+// @Router       /auth/logout [post]
+func (h *HTTPHandlers) HandlerLogout(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
+		return
+	}
+	tokenString := ""
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		tokenString = authHeader[7:]
+	} else {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header format"})
+		return
+	}
+	var req model.LogoutReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format"})
+			return
+		}
+	}
+	err := h.AuthService.Logout(c.Request.Context(), tokenString)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "logout failed"})
+		return
+	}
+	if req.RefreshToken != "" {
+		if err := h.AuthService.RevokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+			c.JSON(500, gin.H{"error": "logout failed"})
+			return
+		}
+	}
+	c.JSON(200, gin.H{"message": "logged out"})
+}
+
+// @Summary      Выход на всех устройствах
+// @Description  Отзывает все access- и refresh-токены текущего пользователя, включая переданный. Требует действующий Bearer-токен.
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}  "Все сессии завершены"
+// @Failure      401  {object}  map[string]interface{}  "Токен отсутствует, недействителен или отозван"
+// @Failure      500  {object}  map[string]interface{}  "Внутренняя ошибка сервера (ошибка БД или Redis)"
+// @Router       /auth/logout-all [post]
+func (h *HTTPHandlers) HandlerLogoutAll(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	if err := h.AuthService.LogoutAll(c.Request.Context(), claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out everywhere"})
+}
+
+// @Summary      Получить профиль пользователя (бета покачто)
+// @Description  Возвращает информацию о текущем авторизованном пользователе (из JWT claims)
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]interface{} "Данные профиля"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Router       /user/profile [get]
+func (h *HTTPHandlers) HandlerGetProfile(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     claims.UserID,
+		"role":        claims.Role,
+		"role_name":   model.RoleNames[claims.Role],
+		"permissions": claims.Permissions(),
+	})
+}
@@ -1,29 +1,127 @@
-package https
-
-import (
-	_ "friend-help/docs"
-
-	"github.com/gin-gonic/gin"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
-)
-
-func NewHTTPServer(httpHandlers *HTTPHandlers, addr string) {
-	router := gin.Default()
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	apiGroup := router.Group("/api")
-	{
-		authGroup := apiGroup.Group("/auth")
-		{
-			authGroup.POST("/reg", httpHandlers.HandlerReg)       // POST /api/auth/reg
-			authGroup.POST("/login", httpHandlers.HandlerLogin)   //POST /api/auth/login
-			authGroup.POST("/logout", httpHandlers.HandlerLogout) //POST /api/auth/logout
-		}
-		user := apiGroup.Group("/user")
-		user.Use(httpHandlers.AuthMiddleware())
-		{
-			user.GET("/profile", httpHandlers.HandlerGetProfile)
-		}
-	}
-	router.Run(addr)
-}
+package https
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	_ "friend-help/docs"
+	"friend-help/internal/model"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// shutdownTimeout — сколько ждать завершения начатых запросов при остановке.
+const shutdownTimeout = 15 * time.Second
+
+// NewHTTPServer обслуживает API, пока не отменён ctx, затем дожидается
+// начатых запросов и возвращает управление.
+func NewHTTPServer(ctx context.Context, httpHandlers *HTTPHandlers, addr string) error {
+	router := gin.Default()
+	if err := configureTrustedProxies(router); err != nil {
+		return err
+	}
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/.well-known/jwks.json", httpHandlers.HandlerJWKS)
+	router.GET("/.well-known/openid-configuration", httpHandlers.HandlerOpenIDConfiguration)
+	apiGroup := router.Group("/api")
+	{
+		limits := httpHandlers.RateLimits
+		regLimit := httpHandlers.RateLimit(limits.Register, RateLimitByIP)
+		loginLimit := httpHandlers.RateLimit(limits.Login, RateLimitByIP)
+		logoutLimit := httpHandlers.RateLimit(limits.Logout, RateLimitByIP)
+		authGroup := apiGroup.Group("/auth")
+		authGroup.Use(httpHandlers.RateLimit(limits.Auth, RateLimitByIP))
+		{
+			authGroup.POST("/reg", regLimit, httpHandlers.HandlerReg)          // POST /api/auth/reg
+			authGroup.POST("/login", loginLimit, httpHandlers.HandlerLogin)    //POST /api/auth/login
+			authGroup.POST("/refresh", httpHandlers.HandlerRefresh)            //POST /api/auth/refresh
+			authGroup.POST("/logout", logoutLimit, httpHandlers.HandlerLogout) //POST /api/auth/logout
+			authGroup.POST("/logout-all", httpHandlers.AuthMiddleware(), httpHandlers.HandlerLogoutAll)
+			authGroup.GET("/verify-email", httpHandlers.HandlerVerifyEmail)
+			authGroup.POST("/verify-email", httpHandlers.HandlerVerifyEmail)
+			authGroup.POST("/verify-email/resend", httpHandlers.HandlerResendVerification)
+			authGroup.POST("/password/forgot", httpHandlers.HandlerForgotPassword)
+			authGroup.POST("/password/reset", httpHandlers.HandlerResetPassword)
+			authGroup.POST("/mfa/verify", httpHandlers.HandlerMFAVerify)
+			authGroup.POST("/mfa/webauthn/begin", httpHandlers.HandlerWebAuthnMFABegin)
+			authGroup.POST("/mfa/webauthn/finish", httpHandlers.HandlerWebAuthnMFAFinish)
+			authGroup.POST("/webauthn/login/begin", httpHandlers.HandlerWebAuthnLoginBegin)
+			authGroup.POST("/webauthn/login/finish", loginLimit, httpHandlers.HandlerWebAuthnLoginFinish)
+		}
+		userLimit := httpHandlers.RateLimit(limits.User, RateLimitByUser)
+		// смена пароля доступна и с password_change_token, поэтому она вне группы /user
+		apiGroup.POST("/user/password", httpHandlers.PasswordChangeAuth(), userLimit, httpHandlers.HandlerChangePassword)
+		user := apiGroup.Group("/user")
+		user.Use(httpHandlers.AuthMiddleware(), userLimit)
+		{
+			user.GET("/profile", httpHandlers.HandlerGetProfile)
+			user.GET("/sessions", httpHandlers.HandlerListSessions)
+			user.DELETE("/sessions/:id", httpHandlers.HandlerRevokeSession)
+			user.POST("/mfa/totp/setup", httpHandlers.HandlerTOTPSetup)
+			user.POST("/mfa/totp/confirm", httpHandlers.HandlerTOTPConfirm)
+			user.POST("/mfa/totp/disable", httpHandlers.HandlerTOTPDisable)
+			user.POST("/mfa/recovery-codes", httpHandlers.HandlerRegenerateRecoveryCodes)
+			user.POST("/mfa/webauthn/register/begin", httpHandlers.HandlerWebAuthnRegisterBegin)
+			user.POST("/mfa/webauthn/register/finish", httpHandlers.HandlerWebAuthnRegisterFinish)
+			user.GET("/mfa/webauthn/credentials", httpHandlers.HandlerWebAuthnCredentials)
+			user.DELETE("/mfa/webauthn/credentials/:id", httpHandlers.HandlerWebAuthnDelete)
+		}
+		authz := apiGroup.Group("/authz")
+		authz.Use(httpHandlers.AuthMiddleware())
+		{
+			authz.POST("/check", httpHandlers.HandlerAuthzCheck)
+		}
+		// Без POLICY_FILE движок запрещает всё, поэтому политики на админских
+		// маршрутах включаются вместе с файлом, иначе администраторы потеряли бы доступ.
+		adminPolicy := func(action string) gin.HandlerFunc {
+			if !httpHandlers.Policy.Enabled() {
+				return func(c *gin.Context) { c.Next() }
+			}
+			return httpHandlers.RequirePolicy(action, nil)
+		}
+		admin := apiGroup.Group("/admin")
+		admin.Use(httpHandlers.AuthMiddleware(), httpHandlers.RequireRole(model.Admin))
+		{
+			admin.PUT("/users/:id/role", httpHandlers.RequirePermission("roles:assign"), adminPolicy("admin:roles.assign"), httpHandlers.HandlerSetUserRole)
+		}
+	}
+	server := &http.Server{Addr: addr, Handler: router}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// configureTrustedProxies читает TRUSTED_PROXIES — IP и подсети балансировщиков
+// через запятую, которым разрешено передавать адрес клиента в X-Forwarded-For
+// и X-Real-IP. Без переменной заголовкам никто не доверяет и c.ClientIP() —
+// адрес соединения: иначе клиент сам выбирал бы IP для лимитов и блокировок.
+func configureTrustedProxies(router *gin.Engine) error {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("var TRUSTED_PROXIES bad format: %w", err)
+	}
+	return nil
+}
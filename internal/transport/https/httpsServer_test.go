@@ -0,0 +1,127 @@
+package https
+
+import (
+	"context"
+	"errors"
+	"friend-help/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func rateLimitKey(t *testing.T, trustedProxies string) string {
+	t.Helper()
+	t.Setenv("TRUSTED_PROXIES", trustedProxies)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := configureTrustedProxies(router); err != nil {
+		t.Fatalf("configureTrustedProxies: %v", err)
+	}
+	var key string
+	router.GET("/", func(c *gin.Context) { key = RateLimitByIP(c) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:41000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return key
+}
+
+func TestRateLimitIgnoresForwardedForByDefault(t *testing.T) {
+	if key := rateLimitKey(t, ""); key != "ip:10.0.0.5" {
+		t.Fatalf("key = %q, want ip:10.0.0.5", key)
+	}
+}
+
+func TestRateLimitUsesForwardedForFromTrustedProxy(t *testing.T) {
+	if key := rateLimitKey(t, " 10.0.0.0/8 ,192.168.1.1"); key != "ip:203.0.113.7" {
+		t.Fatalf("key = %q, want ip:203.0.113.7", key)
+	}
+}
+
+func TestConfigureTrustedProxiesRejectsBadValue(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if err := configureTrustedProxies(gin.New()); err == nil {
+		t.Fatal("want error for bad TRUSTED_PROXIES")
+	}
+}
+
+func TestClientInfoIgnoresSpoofedForwardedFor(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := configureTrustedProxies(router); err != nil {
+		t.Fatalf("configureTrustedProxies: %v", err)
+	}
+	var ip string
+	router.POST("/login", func(c *gin.Context) { ip = clientInfo(c).IP })
+
+	for _, spoofed := range []string{"203.0.113.7", "203.0.113.8"} {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "198.51.100.20:52000"
+		req.Header.Set("X-Forwarded-For", spoofed)
+		req.Header.Set("X-Real-IP", spoofed)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if ip != "198.51.100.20" {
+			t.Fatalf("clientInfo IP = %q with X-Forwarded-For %s, want 198.51.100.20", ip, spoofed)
+		}
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, rule ratelimit.Rule) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("redis is down")
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &HTTPHandlers{Limiter: ratelimit.NewMemoryLimiter()}
+	router := gin.New()
+	router.POST("/login", h.RateLimit(ratelimit.Rule{Name: "login", Limit: 2, Window: time.Minute}, RateLimitByIP), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := request("198.51.100.20:52000")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != remaining {
+			t.Fatalf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, remaining)
+		}
+		if w.Header().Get("Retry-After") != "" {
+			t.Fatalf("request %d: Retry-After on an allowed request", i+1)
+		}
+	}
+	w := request("198.51.100.20:52000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: status %d, want 429", w.Code)
+	}
+	// окно — минута, а секунды округляются вверх: клиент не повторит запрос раньше времени
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Fatalf("Retry-After = %q, want 60", got)
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Reset") != "60" {
+		t.Fatalf("rate limit headers = %v", w.Header())
+	}
+	if w := request("198.51.100.21:52000"); w.Code != http.StatusNoContent {
+		t.Fatalf("another client: status %d", w.Code)
+	}
+
+	// если хранилище счётчиков не ответило, запрос пропускается
+	h.Limiter = failingLimiter{}
+	if w := request("198.51.100.20:52000"); w.Code != http.StatusNoContent {
+		t.Fatalf("limiter error: status %d, want the request to pass", w.Code)
+	}
+}
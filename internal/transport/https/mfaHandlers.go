@@ -0,0 +1,204 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Подключение TOTP
+// @Description  Создаёт секрет для приложения-аутентификатора и возвращает его вместе с otpauth-ссылкой для QR-кода. Секрет хранится зашифрованным; второй фактор включается только после /confirm. Повторный вызов до подтверждения выдаёт новый секрет.
+// @Tags         mfa
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} model.TOTPSetupResp "Секрет и otpauth-ссылка"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      409 {object} map[string]interface{} "TOTP уже подключён"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "MFA не настроена на сервере (нет MFA_ENCRYPTION_KEY)"
+// @Router       /user/mfa/totp/setup [post]
+func (h *HTTPHandlers) HandlerTOTPSetup(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	resp, err := h.AuthService.SetupTOTP(c.Request.Context(), claims.UserID)
+	if err != nil {
+		respondMFAError(c, err, "failed to set up TOTP")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary      Подтверждение TOTP
+// @Description  Включает второй фактор, если код из приложения подходит к выданному секрету, и возвращает 10 одноразовых кодов восстановления. Коды показываются только один раз.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.TOTPCodeReq true "Код из приложения"
+// @Success      200 {object} model.RecoveryCodesResp "TOTP включён, коды восстановления"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON или неверный код"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      404 {object} map[string]interface{} "Подключение не начато (/setup)"
+// @Failure      409 {object} map[string]interface{} "TOTP уже подключён"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /user/mfa/totp/confirm [post]
+func (h *HTTPHandlers) HandlerTOTPConfirm(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	var req model.TOTPCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	codes, err := h.AuthService.ConfirmTOTP(c.Request.Context(), claims.UserID, req.Code, clientInfo(c))
+	if err != nil {
+		respondMFAError(c, err, "failed to confirm TOTP")
+		return
+	}
+	c.JSON(http.StatusOK, model.RecoveryCodesResp{RecoveryCodes: codes})
+}
+
+// @Summary      Отключение TOTP
+// @Description  Отключает второй фактор и удаляет коды восстановления. Требует текущий пароль и действующий код из приложения.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.TOTPDisableReq true "Пароль и код"
+// @Success      200 {object} map[string]interface{} "TOTP отключён"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON или неверный код"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      403 {object} map[string]interface{} "Неверный пароль"
+// @Failure      404 {object} map[string]interface{} "TOTP не подключён"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток, неверный пароль тоже считается (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /user/mfa/totp/disable [post]
+func (h *HTTPHandlers) HandlerTOTPDisable(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	var req model.TOTPDisableReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	if err := h.AuthService.DisableTOTP(c.Request.Context(), claims.UserID, req.Password, req.Code, clientInfo(c)); err != nil {
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidCurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is incorrect"})
+			return
+		}
+		respondMFAError(c, err, "failed to disable TOTP")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP disabled"})
+}
+
+// @Summary      Новые коды восстановления
+// @Description  Выдаёт новый набор из 10 одноразовых кодов восстановления; прежние коды перестают действовать. Требует текущий пароль и подключённый TOTP.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.RecoveryCodesReq true "Текущий пароль"
+// @Success      200 {object} model.RecoveryCodesResp "Новые коды восстановления"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      403 {object} map[string]interface{} "Неверный пароль"
+// @Failure      404 {object} map[string]interface{} "TOTP не подключён"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток, неверный пароль тоже считается (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /user/mfa/recovery-codes [post]
+func (h *HTTPHandlers) HandlerRegenerateRecoveryCodes(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	var req model.RecoveryCodesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	codes, err := h.AuthService.RegenerateRecoveryCodes(c.Request.Context(), claims.UserID, req.Password, clientInfo(c))
+	if err != nil {
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidCurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is incorrect"})
+			return
+		}
+		respondMFAError(c, err, "failed to regenerate recovery codes")
+		return
+	}
+	c.JSON(http.StatusOK, model.RecoveryCodesResp{RecoveryCodes: codes})
+}
+
+// @Summary      Второй шаг входа
+// @Description  Обменивает mfa_token, полученный при входе по паролю, и код второго фактора (или одноразовый код восстановления) на пару токенов. На один mfa_token даётся 5 попыток, он действует 5 минут.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.MFAVerifyReq true "mfa_token и код либо recovery_code"
+// @Success      200 {object} map[string]interface{} "Успешный вход и выдан токен"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Failure      401 {object} map[string]interface{} "mfa_token недействителен, истёк или исчерпаны попытки; неверный код"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /auth/mfa/verify [post]
+func (h *HTTPHandlers) HandlerMFAVerify(c *gin.Context) {
+	var req model.MFAVerifyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	result, err := h.AuthService.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code, req.RecoveryCode, clientInfo(c))
+	if err != nil {
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidActionToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token, log in again"})
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidTOTPCode) || errors.Is(err, errs.ErrInvalidRecoveryCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify second factor"})
+		return
+	}
+	respondLogin(c, result)
+}
+
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, errs.ErrMFANotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrTOTPNotEnabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrInvalidTOTPCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,43 +1,201 @@
-package https
-
-import (
-	"context"
-	"net/http"
-	"strings"
-
-	"github.com/gin-gonic/gin"
-)
-
-func (h *HTTPHandlers) AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
-			return
-		}
-		tokenString := ""
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString = authHeader[7:]
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header format"})
-			return
-		}
-		isBlacklisted, err := h.AuthService.IsTokenBlacklisted(c.Request.Context(), tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check token status"})
-			return
-		}
-		if isBlacklisted {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
-			return
-		}
-		claims, err := h.AuthService.ParseTokenAndGetClaims(tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			return
-		}
-		ctx := context.WithValue(c.Request.Context(), UserCtxKey, claims)
-		c.Request = c.Request.WithContext(ctx)
-		c.Next()
-	}
-}
+package https
+
+import (
+	"context"
+	"friend-help/internal/policy"
+	"friend-help/internal/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *HTTPHandlers) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
+			return
+		}
+		tokenString := ""
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString = authHeader[7:]
+		} else {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header format"})
+			return
+		}
+		claims, err := h.AuthService.ParseTokenAndGetClaims(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		isBlacklisted, err := h.AuthService.IsTokenBlacklisted(c.Request.Context(), claims, tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check token status"})
+			return
+		}
+		if isBlacklisted {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+		isCurrent, err := h.AuthService.IsTokenVersionCurrent(c.Request.Context(), claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check token status"})
+			return
+		}
+		if !isCurrent {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+		h.AuthService.TouchSession(c.Request.Context(), claims)
+		ctx := context.WithValue(c.Request.Context(), UserCtxKey, claims)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// PasswordChangeAuth — AuthMiddleware для маршрута смены пароля, который
+// дополнительно принимает password_change_token, выданный при входе с
+// истёкшим паролем. Другие маршруты этот токен не принимают.
+func (h *HTTPHandlers) PasswordChangeAuth() gin.HandlerFunc {
+	auth := h.AuthMiddleware()
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			claims, err := h.AuthService.ParsePasswordChangeToken(c.Request.Context(), tokenString)
+			if err == nil {
+				ctx := context.WithValue(c.Request.Context(), UserCtxKey, claims)
+				ctx = context.WithValue(ctx, PasswordChangeTokenCtxKey, tokenString)
+				c.Request = c.Request.WithContext(ctx)
+				c.Next()
+				return
+			}
+		}
+		auth(c)
+	}
+}
+
+// RequireRole пропускает запрос, только если роль из токена входит в roles.
+// Должен стоять после AuthMiddleware.
+func (h *HTTPHandlers) RequireRole(roles ...int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+	}
+}
+
+// RequirePermission пропускает запрос, только если в scope токена есть все права permissions.
+// Должен стоять после AuthMiddleware.
+func (h *HTTPHandlers) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission", "permission": permission})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// ResourceFunc собирает атрибуты resource.* для RequirePolicy,
+// например, загружая владельца объекта из БД.
+type ResourceFunc func(c *gin.Context) (map[string]interface{}, error)
+
+// RequirePolicy проверяет действие action по политикам из POLICY_FILE.
+// Если resource равен nil, атрибутами ресурса становятся параметры пути (:id и т.п.).
+// Должен стоять после AuthMiddleware.
+func (h *HTTPHandlers) RequirePolicy(action string, resource ResourceFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+		attrs := pathParams(c)
+		if resource != nil {
+			var err error
+			attrs, err = resource(c)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load resource"})
+				return
+			}
+		}
+		decision := h.Policy.Evaluate(policy.Input{
+			Action:   action,
+			Subject:  policy.SubjectFromClaims(claims),
+			Resource: attrs,
+			Request:  requestAttributes(c),
+		})
+		if !decision.Allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied by policy", "policy_id": decision.PolicyID})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitKeyFunc определяет, чей это запрос для лимита: IP или пользователь.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitByIP считает по адресу клиента; X-Forwarded-For учитывается,
+// только если запрос пришёл от прокси из TRUSTED_PROXIES.
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser считает по пользователю из токена, а для анонимных запросов — по IP.
+// Должен стоять после AuthMiddleware.
+func RateLimitByUser(c *gin.Context) string {
+	if claims, ok := GetUserFromContext(c.Request.Context()); ok {
+		return "user:" + strconv.Itoa(claims.UserID)
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimit ограничивает частоту запросов по правилу rule и выставляет заголовки
+// X-RateLimit-Limit, X-RateLimit-Remaining и X-RateLimit-Reset (секунды до
+// освобождения места); сверх лимита отвечает 429 с Retry-After.
+func (h *HTTPHandlers) RateLimit(rule ratelimit.Rule, key RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.Limiter == nil || !rule.Enabled() {
+			c.Next()
+			return
+		}
+		result, err := h.Limiter.Allow(c.Request.Context(), key(c), rule)
+		if err != nil {
+			// без хранилища счётчиков лимит не проверить; отказывать всем хуже
+			slog.WarnContext(c.Request.Context(), "rate limit check failed", "rule", rule.Name, "error", err)
+			c.Next()
+			return
+		}
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", reset)
+		if !result.Allowed {
+			c.Header("Retry-After", reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,196 @@
+package https
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"friend-help/internal/cache"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"friend-help/internal/passhash"
+	"friend-help/internal/repo"
+	"friend-help/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// stubRepo хранит одного пользователя. Встроенные интерфейсы остаются nil:
+// вызов метода, который middleware не нужен, упадёт и укажет на него.
+type stubRepo struct {
+	repo.AuthRepo
+	repo.SessionRepo
+	repo.MFARepo
+	user model.AuthUser
+}
+
+func (r *stubRepo) GetUserByLoginOrEmail(ctx context.Context, identifier string) (*model.AuthUser, error) {
+	if identifier != r.user.Login {
+		return nil, errs.ErrUserNotFound
+	}
+	user := r.user
+	return &user, nil
+}
+
+func (r *stubRepo) GetUserByID(ctx context.Context, userID int) (*model.AuthUser, error) {
+	if userID != r.user.ID {
+		return nil, errs.ErrUserNotFound
+	}
+	user := r.user
+	return &user, nil
+}
+
+func (r *stubRepo) GetTokenVersion(ctx context.Context, userID int) (int, error) {
+	return r.user.TokenVersion, nil
+}
+
+func (r *stubRepo) IncrementTokenVersion(ctx context.Context, userID int) (int, error) {
+	r.user.TokenVersion++
+	return r.user.TokenVersion, nil
+}
+
+func (r *stubRepo) GetRolePermissions(ctx context.Context, role int) ([]string, error) {
+	return nil, nil
+}
+
+func (r *stubRepo) CreateSession(ctx context.Context, session model.Session) error { return nil }
+
+func (r *stubRepo) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	return nil
+}
+
+func (r *stubRepo) RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *stubRepo) GetTOTP(ctx context.Context, userID int) (*model.TOTPSecret, error) {
+	return nil, errs.ErrTOTPNotEnabled
+}
+
+func (r *stubRepo) ListWebAuthnCredentials(ctx context.Context, userID int) ([]model.WebAuthnCredential, error) {
+	return nil, nil
+}
+
+func (r *stubRepo) Record(ctx context.Context, event model.AuditEvent) error { return nil }
+
+// newPasswordChangeRouter собирает маршрут смены пароля и обычный защищённый
+// маршрут поверх AuthService с одним пользователем alice.
+func newPasswordChangeRouter(t *testing.T) (*gin.Engine, *service.AuthService, *stubRepo) {
+	t.Helper()
+	redisServer := miniredis.RunT(t)
+	redisServer.RequireAuth("test")
+	key := make([]byte, 32)
+	rand.Read(key)
+	for k, v := range map[string]string{
+		"REDIS_ADDR":            redisServer.Addr(),
+		"REDIS_PASS":            "test",
+		"JWT_ALG":               "HS256",
+		"JWT_SECRET_KEY":        "test-secret-key-of-sufficient-length",
+		"MFA_ENCRYPTION_KEY":    base64.StdEncoding.EncodeToString(key),
+		"ARGON2_MEMORY_KIB":     "64",
+		"ARGON2_ITERATIONS":     "1",
+		"ARGON2_PARALLELISM":    "1",
+		"PASSWORD_MAX_AGE_DAYS": "30",
+	} {
+		t.Setenv(k, v)
+	}
+	redisService, err := cache.NewRedisService()
+	if err != nil {
+		t.Fatalf("NewRedisService: %v", err)
+	}
+	jwtService, err := service.NewJwtService()
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	hasher, err := passhash.NewFromEnv()
+	if err != nil {
+		t.Fatalf("NewFromEnv: %v", err)
+	}
+	hash, err := hasher.Hash("Correct-horse-42")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	stub := &stubRepo{user: model.AuthUser{
+		ID: 1, Login: "alice", Username: "alice", PasswordHash: hash,
+		PasswordChangedAt: time.Now(), IsActivated: true, Role: model.Member,
+	}}
+	authService, err := service.NewAuthService(stub, stub, stub, stub, jwtService, redisService, nil)
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := &HTTPHandlers{AuthService: authService}
+	router := gin.New()
+	whoami := func(c *gin.Context) {
+		claims, _ := GetUserFromContext(c.Request.Context())
+		_, changeToken := GetPasswordChangeTokenFromContext(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"user_id": claims.UserID, "password_change": changeToken})
+	}
+	router.POST("/user/password", h.PasswordChangeAuth(), whoami)
+	router.GET("/user/me", h.AuthMiddleware(), whoami)
+	return router, authService, stub
+}
+
+func login(t *testing.T, authService *service.AuthService) *model.LoginResult {
+	t.Helper()
+	result, err := authService.Authenticate(context.Background(), "alice", "Correct-horse-42", model.ClientInfo{IP: "203.0.113.7"})
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return result
+}
+
+func serve(router *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordChangeAuth(t *testing.T) {
+	router, authService, stub := newPasswordChangeRouter(t)
+	access := login(t, authService).Tokens.AccessToken
+
+	stub.user.PasswordChangedAt = time.Now().Add(-31 * 24 * time.Hour)
+	expired := login(t, authService)
+	if !expired.PasswordExpired {
+		t.Fatalf("login with an expired password = %+v, want password_expired", expired)
+	}
+	changeToken := expired.PasswordChangeToken
+
+	cases := []struct {
+		name, method, path, token string
+		status                    int
+		body                      string
+	}{
+		{"change token on password route", http.MethodPost, "/user/password", changeToken, http.StatusOK, `{"password_change":true,"user_id":1}`},
+		{"access token on password route", http.MethodPost, "/user/password", access, http.StatusOK, `{"password_change":false,"user_id":1}`},
+		{"change token elsewhere", http.MethodGet, "/user/me", changeToken, http.StatusUnauthorized, ""},
+		{"access token elsewhere", http.MethodGet, "/user/me", access, http.StatusOK, `{"password_change":false,"user_id":1}`},
+		{"garbage on password route", http.MethodPost, "/user/password", "garbage", http.StatusUnauthorized, ""},
+		{"no token on password route", http.MethodPost, "/user/password", "", http.StatusUnauthorized, ""},
+	}
+	for _, c := range cases {
+		w := serve(router, c.method, c.path, c.token)
+		if w.Code != c.status || (c.body != "" && w.Body.String() != c.body) {
+			t.Errorf("%s: %d %s, want %d %s", c.name, w.Code, w.Body, c.status, c.body)
+		}
+	}
+
+	if err := authService.LogoutAll(context.Background(), stub.user.ID); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	for _, token := range []string{changeToken, access} {
+		if w := serve(router, http.MethodPost, "/user/password", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("token after LogoutAll: %d %s, want 401", w.Code, w.Body)
+		}
+	}
+}
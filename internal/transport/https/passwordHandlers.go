@@ -0,0 +1,144 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Запрос сброса пароля
+// @Description  Отправляет на email ссылку с одноразовым токеном для сброса пароля (не чаще раза в минуту). Ответ всегда 200, чтобы не раскрывать наличие учётной записи.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        Accept-Language header string false "Язык письма (ru или en)"
+// @Param        input body model.ForgotPasswordReq true "Email учётной записи"
+// @Success      200 {object} map[string]interface{} "Запрос принят"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON или email"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД)"
+// @Router       /auth/password/forgot [post]
+func (h *HTTPHandlers) HandlerForgotPassword(c *gin.Context) {
+	var req model.ForgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	if err := h.AuthService.ForgotPassword(c.Request.Context(), req.Email, clientInfo(c).Language); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process request"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "if the account exists, a password reset link has been sent"})
+}
+
+// @Summary      Сброс пароля
+// @Description  Устанавливает новый пароль по одноразовому токену из письма. Все токены и сессии пользователя отзываются, после сброса нужно войти заново.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.ResetPasswordReq true "Токен из письма и новый пароль"
+// @Success      200 {object} map[string]interface{} "Пароль изменён"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON, токен недействителен, истёк или уже использован, либо пароль нарушает парольную политику (список нарушений в violations; токен при этом не гасится)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, Redis или хеширования)"
+// @Router       /auth/password/reset [post]
+func (h *HTTPHandlers) HandlerResetPassword(c *gin.Context) {
+	var req model.ResetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	if err := h.AuthService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid, expired or already used token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset, please log in again"})
+}
+
+// @Summary      Смена пароля
+// @Description  Меняет пароль текущего пользователя после проверки действующего. Все остальные сессии завершаются, все ранее выданные токены (включая переданный) отзываются; в ответе — новая пара токенов для текущей сессии. Вместо access-токена принимает password_change_token, выданный при входе с истёкшим паролем: он одноразовый, а в ответе — пара токенов новой сессии. Новый пароль не должен совпадать с последними PASSWORD_HISTORY_SIZE паролями.
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.ChangePasswordReq true "Текущий и новый пароль"
+// @Success      200 {object} model.TokenPair "Пароль изменён, выдана новая пара токенов"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON, новый пароль совпадает с текущим, с одним из недавних или нарушает парольную политику (список нарушений в violations)"
+// @Failure      401 {object} map[string]interface{} "Токен (access или password_change_token) отсутствует, недействителен, отозван или уже использован"
+// @Failure      403 {object} map[string]interface{} "Неверный текущий пароль или, для password_change_token, email не подтверждён"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток, неверный текущий пароль тоже считается (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД, Redis или хеширования)"
+// @Router       /user/password [post]
+func (h *HTTPHandlers) HandlerChangePassword(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	var req model.ChangePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	var tokens *model.TokenPair
+	var err error
+	if changeToken, ok := GetPasswordChangeTokenFromContext(c.Request.Context()); ok {
+		tokens, err = h.AuthService.ChangeExpiredPassword(c.Request.Context(), changeToken, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	} else {
+		tokens, err = h.AuthService.ChangePassword(c.Request.Context(), claims, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrInvalidCurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "current password is incorrect"})
+			return
+		}
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotActivated) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+		if respondPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrPasswordUnchanged) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidActionToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid, expired or already used password change token"})
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session has been revoked"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// respondPasswordPolicy отвечает 400 со списком нарушенных правил парольной политики.
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *errs.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": errs.ErrWeakPassword.Error(), "violations": policyErr.Violations})
+	return true
+}
@@ -0,0 +1,61 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Список активных сессий
+// @Description  Возвращает активные сессии текущего пользователя (устройство, IP, время входа и последней активности). Текущая сессия помечена current=true.
+// @Tags         user
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {array}  model.Session "Активные сессии"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД)"
+// @Router       /user/sessions [get]
+func (h *HTTPHandlers) HandlerListSessions(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	sessions, err := h.AuthService.ListSessions(c.Request.Context(), claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary      Завершить сессию
+// @Description  Отзывает выбранную сессию текущего пользователя: её refresh-токены и уже выданные access-токены перестают приниматься.
+// @Tags         user
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path      string true "ID сессии"
+// @Success      200 {object}  map[string]interface{} "Сессия завершена"
+// @Failure      401 {object}  map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      404 {object}  map[string]interface{} "Сессия не найдена"
+// @Failure      500 {object}  map[string]interface{} "Внутренняя ошибка сервера (ошибка БД или Redis)"
+// @Router       /user/sessions/{id} [delete]
+func (h *HTTPHandlers) HandlerRevokeSession(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	err := h.AuthService.RevokeSession(c.Request.Context(), claims.UserID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
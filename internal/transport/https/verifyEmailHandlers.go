@@ -0,0 +1,73 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Подтверждение email
+// @Description  Активирует учётную запись по одноразовому токену из письма. GET принимает токен в query (?token=...), чтобы работала ссылка из письма, POST — в теле запроса.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token query string               false "Токен из письма (для GET)"
+// @Param        input body  model.VerifyEmailReq false "Токен из письма (для POST)"
+// @Success      200 {object} map[string]interface{} "Email подтверждён"
+// @Failure      400 {object} map[string]interface{} "Токен отсутствует, недействителен, истёк или уже использован"
+// @Failure      404 {object} map[string]interface{} "Пользователь не найден"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера (ошибка БД или Redis)"
+// @Router       /auth/verify-email [get]
+// @Router       /auth/verify-email [post]
+func (h *HTTPHandlers) HandlerVerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if c.Request.Method == http.MethodPost {
+		var req model.VerifyEmailReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing token"})
+		return
+	}
+	userID, err := h.AuthService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, errs.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid, expired or already used token"})
+			return
+		}
+		if errors.Is(err, errs.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "message": "email verified"})
+}
+
+// @Summary      Повторная отправка письма подтверждения
+// @Description  Отправляет новое письмо со ссылкой, если учётная запись существует и ещё не подтверждена (не чаще раза в минуту). Ответ всегда 202, в том числе при сбое отправки, чтобы не раскрывать наличие учётной записи.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        Accept-Language header string false "Язык письма (ru или en)"
+// @Param        input body model.ResendVerificationReq true "Логин или email"
+// @Success      202 {object} map[string]interface{} "Запрос принят"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Router       /auth/verify-email/resend [post]
+func (h *HTTPHandlers) HandlerResendVerification(c *gin.Context) {
+	var req model.ResendVerificationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	h.AuthService.ResendVerificationEmail(c.Request.Context(), req.Identifier, clientInfo(c).Language)
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists and is not verified, a new email has been sent"})
+}
@@ -0,0 +1,273 @@
+package https
+
+import (
+	"errors"
+	"friend-help/internal/errs"
+	"friend-help/internal/model"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Начало регистрации passkey
+// @Description  Возвращает challenge_id и параметры для navigator.credentials.create(). Challenge действует 5 минут и принимается один раз.
+// @Tags         mfa
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} model.WebAuthnBeginResp "Параметры церемонии"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере (нет WEBAUTHN_RP_ID)"
+// @Router       /user/mfa/webauthn/register/begin [post]
+func (h *HTTPHandlers) HandlerWebAuthnRegisterBegin(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	resp, err := h.AuthService.BeginWebAuthnRegistration(c.Request.Context(), claims.UserID)
+	if err != nil {
+		respondWebAuthnError(c, err, "failed to begin passkey registration")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary      Завершение регистрации passkey
+// @Description  Проверяет ответ аутентификатора и сохраняет passkey. После этого вход по паролю требует второй фактор. Если это первый второй фактор, в ответе есть коды восстановления — они показываются только один раз.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body model.WebAuthnRegisterFinishReq true "challenge_id, название и ответ navigator.credentials.create()"
+// @Success      201 {object} model.WebAuthnRegisterFinishResp "Passkey сохранён"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON, challenge или ответ аутентификатора"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      409 {object} map[string]interface{} "Passkey уже зарегистрирован"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере"
+// @Router       /user/mfa/webauthn/register/finish [post]
+func (h *HTTPHandlers) HandlerWebAuthnRegisterFinish(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	var req model.WebAuthnRegisterFinishReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	resp, err := h.AuthService.FinishWebAuthnRegistration(c.Request.Context(), claims.UserID, req.ChallengeID, req.Name, req.Credential, clientInfo(c))
+	if err != nil {
+		respondWebAuthnError(c, err, "failed to register passkey")
+		return
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary      Список passkey
+// @Description  Возвращает passkey текущего пользователя.
+// @Tags         mfa
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]interface{} "Список passkey"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /user/mfa/webauthn/credentials [get]
+func (h *HTTPHandlers) HandlerWebAuthnCredentials(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	credentials, err := h.AuthService.ListWebAuthnCredentials(c.Request.Context(), claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list passkeys"})
+		return
+	}
+	if credentials == nil {
+		credentials = []model.WebAuthnCredential{}
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// @Summary      Удаление passkey
+// @Description  Удаляет passkey текущего пользователя. Требует текущий пароль.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path int                     true "ID passkey"
+// @Param        input body model.WebAuthnDeleteReq true "Текущий пароль"
+// @Success      200 {object} map[string]interface{} "Passkey удалён"
+// @Failure      400 {object} map[string]interface{} "Некорректный ID или JSON"
+// @Failure      401 {object} map[string]interface{} "Токен отсутствует, недействителен или отозван"
+// @Failure      403 {object} map[string]interface{} "Неверный пароль"
+// @Failure      404 {object} map[string]interface{} "Passkey не найден"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток, неверный пароль тоже считается (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Router       /user/mfa/webauthn/credentials/{id} [delete]
+func (h *HTTPHandlers) HandlerWebAuthnDelete(c *gin.Context) {
+	claims, ok := GetUserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+	credentialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || credentialID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid passkey id"})
+		return
+	}
+	var req model.WebAuthnDeleteReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	err = h.AuthService.DeleteWebAuthnCredential(c.Request.Context(), claims.UserID, credentialID, req.Password, clientInfo(c))
+	if err != nil {
+		if respondRetryAfter(c, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidCurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is incorrect"})
+			return
+		}
+		respondWebAuthnError(c, err, "failed to delete passkey")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "passkey deleted"})
+}
+
+// @Summary      Начало входа по passkey
+// @Description  Вход без пароля: возвращает challenge_id и параметры для navigator.credentials.get(). Пользователь определяется выбранным passkey; проверка пользователя (PIN, биометрия) обязательна.
+// @Tags         auth
+// @Produce      json
+// @Success      200 {object} model.WebAuthnBeginResp "Параметры церемонии"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере"
+// @Router       /auth/webauthn/login/begin [post]
+func (h *HTTPHandlers) HandlerWebAuthnLoginBegin(c *gin.Context) {
+	resp, err := h.AuthService.BeginWebAuthnLogin(c.Request.Context())
+	if err != nil {
+		respondWebAuthnError(c, err, "failed to begin passkey login")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary      Завершение входа по passkey
+// @Description  Проверяет подпись passkey и выдаёт пару токенов. Второй фактор не запрашивается.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.WebAuthnLoginFinishReq true "challenge_id и ответ navigator.credentials.get()"
+// @Success      200 {object} map[string]interface{} "Успешный вход и выдан токен"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Failure      401 {object} map[string]interface{} "Challenge недействителен или подпись не прошла проверку"
+// @Failure      403 {object} map[string]interface{} "Email не подтверждён"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере"
+// @Router       /auth/webauthn/login/finish [post]
+func (h *HTTPHandlers) HandlerWebAuthnLoginFinish(c *gin.Context) {
+	var req model.WebAuthnLoginFinishReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	result, err := h.AuthService.FinishWebAuthnLogin(c.Request.Context(), req.ChallengeID, req.Credential, clientInfo(c))
+	if err != nil {
+		respondWebAuthnAssertionError(c, err, "failed to process passkey login")
+		return
+	}
+	respondLogin(c, result)
+}
+
+// @Summary      Passkey как второй фактор: начало
+// @Description  Для mfa_token, полученного при входе по паролю, возвращает параметры для navigator.credentials.get() по passkey пользователя.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.WebAuthnMFABeginReq true "mfa_token"
+// @Success      200 {object} model.WebAuthnBeginResp "Параметры церемонии"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Failure      401 {object} map[string]interface{} "mfa_token недействителен или истёк"
+// @Failure      404 {object} map[string]interface{} "У пользователя нет passkey"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере"
+// @Router       /auth/mfa/webauthn/begin [post]
+func (h *HTTPHandlers) HandlerWebAuthnMFABegin(c *gin.Context) {
+	var req model.WebAuthnMFABeginReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	resp, err := h.AuthService.BeginWebAuthnMFA(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		respondWebAuthnAssertionError(c, err, "failed to begin passkey verification")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary      Passkey как второй фактор: завершение
+// @Description  Обменивает mfa_token и подпись passkey на пару токенов. Неудачные попытки расходуют те же 5 попыток mfa_token, что и коды.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body model.WebAuthnMFAFinishReq true "mfa_token, challenge_id и ответ navigator.credentials.get()"
+// @Success      200 {object} map[string]interface{} "Успешный вход и выдан токен"
+// @Failure      400 {object} map[string]interface{} "Некорректный JSON"
+// @Failure      401 {object} map[string]interface{} "mfa_token или challenge недействителен; подпись не прошла проверку"
+// @Failure      423 {object} map[string]interface{} "Учётная запись временно заблокирована после неудачных попыток (заголовок Retry-After)"
+// @Failure      429 {object} map[string]interface{} "Слишком много неудачных попыток с этого IP (заголовок Retry-After)"
+// @Failure      500 {object} map[string]interface{} "Внутренняя ошибка сервера"
+// @Failure      503 {object} map[string]interface{} "WebAuthn не настроен на сервере"
+// @Router       /auth/mfa/webauthn/finish [post]
+func (h *HTTPHandlers) HandlerWebAuthnMFAFinish(c *gin.Context) {
+	var req model.WebAuthnMFAFinishReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input format or missing fields"})
+		return
+	}
+	result, err := h.AuthService.VerifyMFAWebAuthn(c.Request.Context(), req.MFAToken, req.ChallengeID, req.Credential, clientInfo(c))
+	if err != nil {
+		respondWebAuthnAssertionError(c, err, "failed to verify second factor")
+		return
+	}
+	respondLogin(c, result)
+}
+
+func respondWebAuthnError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, errs.ErrWebAuthnNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrInvalidWebAuthnChallenge), errors.Is(err, errs.ErrInvalidWebAuthnCredential):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrWebAuthnCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrWebAuthnCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// respondWebAuthnAssertionError — для входа: отказ в проверке означает 401.
+func respondWebAuthnAssertionError(c *gin.Context, err error, fallback string) {
+	if respondRetryAfter(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, errs.ErrInvalidActionToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token, log in again"})
+	case errors.Is(err, errs.ErrInvalidWebAuthnChallenge), errors.Is(err, errs.ErrInvalidWebAuthnCredential):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrUserNotActivated):
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+	default:
+		respondWebAuthnError(c, err, fallback)
+	}
+}
@@ -0,0 +1,58 @@
+package https
+
+import (
+	"friend-help/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Набор публичных ключей (JWKS)
+// @Description  Публичные части всех действующих ключей подписи в формате RFC 7517. HMAC-ключи не публикуются. Доступен по адресу /.well-known/jwks.json (вне /api).
+// @Tags         well-known
+// @Produce      json
+// @Success      200  {object}  model.JWKSet "Набор ключей"
+// @Router       /.well-known/jwks.json [get]
+func (h *HTTPHandlers) HandlerJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.AuthService.JWKS())
+}
+
+// @Summary      OpenID discovery
+// @Description  Описание издателя токенов, эндпоинтов и поддерживаемых алгоритмов. Доступен по адресу /.well-known/openid-configuration (вне /api).
+// @Tags         well-known
+// @Produce      json
+// @Success      200  {object}  model.OpenIDConfiguration "Discovery-документ"
+// @Router       /.well-known/openid-configuration [get]
+func (h *HTTPHandlers) HandlerOpenIDConfiguration(c *gin.Context) {
+	issuer := h.AuthService.Issuer()
+	if issuer == "" {
+		issuer = requestBaseURL(c)
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, model.OpenIDConfiguration{
+		Issuer:                           issuer,
+		JWKSURI:                          issuer + "/.well-known/jwks.json",
+		TokenEndpoint:                    issuer + "/api/auth/login",
+		RevocationEndpoint:               issuer + "/api/auth/logout",
+		UserinfoEndpoint:                 issuer + "/api/user/profile",
+		RegistrationEndpoint:             issuer + "/api/auth/reg",
+		ResponseTypesSupported:           []string{"token"},
+		GrantTypesSupported:              []string{"password", "refresh_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: h.AuthService.SigningAlgorithms(),
+		TokenEndpointAuthMethods:         []string{"none"},
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "user_id", "role", "ver", "sid", "scope"},
+	})
+}
+
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
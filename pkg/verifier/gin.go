@@ -0,0 +1,30 @@
+package verifier
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinClaimsKey — ключ, под которым claims дополнительно доступны через c.Get.
+const GinClaimsKey = "user_claims"
+
+// GinMiddleware — адаптер для Gin с теми же ответами, что и AuthMiddleware сервиса.
+func (v *Verifier) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := BearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid Authorization header"})
+			return
+		}
+		claims, err := v.Verify(c.Request.Context(), tokenString)
+		if err != nil {
+			status, msg := httpError(err)
+			c.AbortWithStatusJSON(status, gin.H{"error": msg})
+			return
+		}
+		c.Set(GinClaimsKey, claims)
+		c.Request = c.Request.WithContext(WithUser(c.Request.Context(), claims))
+		c.Next()
+	}
+}
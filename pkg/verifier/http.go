@@ -0,0 +1,41 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Middleware — адаптер для net/http: проверяет Bearer-токен и кладёт claims в контекст запроса.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid Authorization header")
+			return
+		}
+		claims, err := v.Verify(r.Context(), tokenString)
+		if err != nil {
+			status, msg := httpError(err)
+			writeJSONError(w, status, msg)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), claims)))
+	})
+}
+
+func httpError(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrTokenRevoked):
+		return http.StatusUnauthorized, "token revoked"
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrMissingToken):
+		return http.StatusUnauthorized, "invalid or expired token"
+	}
+	return http.StatusInternalServerError, "failed to check token status"
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
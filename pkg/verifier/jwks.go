@@ -0,0 +1,257 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"friend-help/internal/model"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefreshInterval = 5 * time.Minute
+	defaultJWKSMinRefresh      = 30 * time.Second
+	defaultJWKSTimeout         = 10 * time.Second
+)
+
+type JWKSOption func(*JWKSSource)
+
+// WithRefreshInterval задаёт период фонового обновления ключей.
+func WithRefreshInterval(interval time.Duration) JWKSOption {
+	return func(s *JWKSSource) {
+		s.refreshInterval = interval
+	}
+}
+
+// WithMinRefreshInterval ограничивает внеплановые обновления при встрече неизвестного kid.
+func WithMinRefreshInterval(interval time.Duration) JWKSOption {
+	return func(s *JWKSSource) {
+		s.minRefresh = interval
+	}
+}
+
+func WithHTTPClient(client *http.Client) JWKSOption {
+	return func(s *JWKSSource) {
+		s.client = client
+	}
+}
+
+// JWKSSource получает ключи с /.well-known/jwks.json, кеширует их
+// и обновляет в фоне, пока не отменён контекст, переданный в NewJWKSSource.
+type JWKSSource struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	minRefresh      time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]Key
+	lastFetched time.Time
+
+	// refreshing выстраивает запросы к JWKS в очередь; lastAttempt — начало
+	// последнего запроса, удачного или нет, читается только под refreshing.
+	refreshing  sync.Mutex
+	lastAttempt time.Time
+}
+
+func NewJWKSSource(ctx context.Context, url string, opts ...JWKSOption) (*JWKSSource, error) {
+	s := &JWKSSource{
+		url:             url,
+		client:          &http.Client{Timeout: defaultJWKSTimeout},
+		refreshInterval: defaultJWKSRefreshInterval,
+		minRefresh:      defaultJWKSMinRefresh,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	go s.refreshLoop(ctx)
+	return s, nil
+}
+
+func (s *JWKSSource) Key(ctx context.Context, kid string) (Key, error) {
+	if key, ok := s.cached(kid); ok {
+		return key, nil
+	}
+	// ключ мог появиться после ротации — обновляемся, но не чаще minRefresh:
+	// иначе токены с выдуманным kid превращали бы каждый запрос в запрос к JWKS
+	if err := s.refresh(ctx, s.minRefresh); err != nil {
+		return Key{}, err
+	}
+	if key, ok := s.cached(kid); ok {
+		return key, nil
+	}
+	return Key{}, ErrUnknownKey
+}
+
+func (s *JWKSSource) cached(kid string) (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Refresh принудительно перечитывает JWKS. При ошибке остаётся прежний кеш.
+func (s *JWKSSource) Refresh(ctx context.Context) error {
+	return s.refresh(ctx, 0)
+}
+
+// refresh перечитывает JWKS, если с начала прошлой попытки прошло не меньше
+// cooldown. Проверка идёт под refreshing, поэтому параллельные вызовы дожидаются
+// одного запроса и не повторяют его; неудачная попытка тоже выдерживает паузу.
+func (s *JWKSSource) refresh(ctx context.Context, cooldown time.Duration) error {
+	s.refreshing.Lock()
+	defer s.refreshing.Unlock()
+	if cooldown > 0 && time.Since(s.lastAttempt) < cooldown {
+		return nil
+	}
+	s.lastAttempt = time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSFetch, err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSFetch, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status %d", ErrJWKSFetch, resp.StatusCode)
+	}
+	var set model.JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSFetch, err)
+	}
+	keys := make(map[string]Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := KeyFromJWK(jwk)
+		if err != nil {
+			slog.Warn("skipping JWK", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.lastFetched = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *JWKSSource) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				slog.Error("JWKS refresh failed, keeping cached keys", "url", s.url, "error", err)
+			}
+		}
+	}
+}
+
+// KeyFromJWK восстанавливает публичный ключ из JWK (RFC 7517/7518/8037).
+func KeyFromJWK(jwk model.JWK) (Key, error) {
+	var public interface{}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeB64(jwk.N)
+		if err != nil {
+			return Key{}, err
+		}
+		e, err := decodeB64(jwk.E)
+		if err != nil {
+			return Key{}, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return Key{}, fmt.Errorf("%w: RSA exponent too large", ErrInvalidPublicKey)
+		}
+		public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	case "EC":
+		x, err := decodeB64(jwk.X)
+		if err != nil {
+			return Key{}, err
+		}
+		y, err := decodeB64(jwk.Y)
+		if err != nil {
+			return Key{}, err
+		}
+		public, err = ecPublicKey(jwk.Crv, x, y)
+		if err != nil {
+			return Key{}, err
+		}
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return Key{}, fmt.Errorf("%w: OKP curve %q", ErrUnsupportedKey, jwk.Crv)
+		}
+		x, err := decodeB64(jwk.X)
+		if err != nil {
+			return Key{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return Key{}, fmt.Errorf("%w: bad Ed25519 key size", ErrInvalidPublicKey)
+		}
+		public = ed25519.PublicKey(x)
+	default:
+		return Key{}, fmt.Errorf("%w: %q", ErrUnsupportedKey, jwk.Kty)
+	}
+	if err := checkKeyMatchesAlg(jwk.Alg, public); err != nil {
+		return Key{}, err
+	}
+	return Key{Alg: jwk.Alg, Public: public}, nil
+}
+
+func ecPublicKey(crv string, x, y []byte) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("%w: EC curve %q", ErrUnsupportedKey, crv)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, fmt.Errorf("%w: bad EC coordinate size", ErrInvalidPublicKey)
+	}
+	point := append([]byte{4}, append(x, y...)...)
+	pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	return pub, nil
+}
+
+func decodeB64(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	return b, nil
+}
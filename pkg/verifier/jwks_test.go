@@ -0,0 +1,242 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"friend-help/internal/model"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func rsaJWK(t *testing.T, kid string) (model.JWK, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return model.JWK{
+		Kty: "RSA", Kid: kid, Use: "sig", Alg: "RS256",
+		N: b64.EncodeToString(key.N.Bytes()),
+		E: b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}, key
+}
+
+func ecJWK(t *testing.T, kid string) (model.JWK, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	raw, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("ecdsa public key bytes: %v", err)
+	}
+	return model.JWK{
+		Kty: "EC", Kid: kid, Use: "sig", Alg: "ES256", Crv: "P-256",
+		X: b64.EncodeToString(raw[1:33]),
+		Y: b64.EncodeToString(raw[33:]),
+	}, key
+}
+
+func okpJWK(t *testing.T, kid string) (model.JWK, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	return model.JWK{Kty: "OKP", Kid: kid, Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: b64.EncodeToString(public)}, private
+}
+
+func TestKeyFromJWK(t *testing.T) {
+	rsaKey, rsaPrivate := rsaJWK(t, "rsa")
+	ecKey, ecPrivate := ecJWK(t, "ec")
+	okpKey, okpPrivate := okpJWK(t, "okp")
+
+	valid := []struct {
+		jwk    model.JWK
+		public interface{ Equal(crypto.PublicKey) bool }
+	}{
+		{rsaKey, &rsaPrivate.PublicKey},
+		{ecKey, &ecPrivate.PublicKey},
+		{okpKey, okpPrivate.Public().(ed25519.PublicKey)},
+	}
+	for _, c := range valid {
+		key, err := KeyFromJWK(c.jwk)
+		if err != nil {
+			t.Fatalf("KeyFromJWK(%s): %v", c.jwk.Kty, err)
+		}
+		if key.Alg != c.jwk.Alg || !c.public.Equal(key.Public) {
+			t.Fatalf("KeyFromJWK(%s) = %+v, want the original %s key", c.jwk.Kty, key, c.jwk.Alg)
+		}
+	}
+
+	modify := func(jwk model.JWK, change func(*model.JWK)) model.JWK {
+		change(&jwk)
+		return jwk
+	}
+	invalid := []struct {
+		name string
+		jwk  model.JWK
+		want error
+	}{
+		{"unknown kty", modify(rsaKey, func(j *model.JWK) { j.Kty = "oct" }), ErrUnsupportedKey},
+		{"RSA key for ES256", modify(rsaKey, func(j *model.JWK) { j.Alg = "ES256" }), ErrInvalidPublicKey},
+		{"RSA modulus not base64url", modify(rsaKey, func(j *model.JWK) { j.N = "***" }), ErrInvalidPublicKey},
+		{"RSA exponent too large", modify(rsaKey, func(j *model.JWK) { j.E = b64.EncodeToString([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0}) }), ErrInvalidPublicKey},
+		{"EC unknown curve", modify(ecKey, func(j *model.JWK) { j.Crv = "secp256k1" }), ErrUnsupportedKey},
+		{"EC P-256 for ES384", modify(ecKey, func(j *model.JWK) { j.Alg = "ES384" }), ErrInvalidPublicKey},
+		{"EC short coordinate", modify(ecKey, func(j *model.JWK) { j.X = b64.EncodeToString(make([]byte, 31)) }), ErrInvalidPublicKey},
+		{"EC point off the curve", modify(ecKey, func(j *model.JWK) { j.Y = j.X }), ErrInvalidPublicKey},
+		{"OKP X25519", modify(okpKey, func(j *model.JWK) { j.Crv = "X25519" }), ErrUnsupportedKey},
+		{"OKP short key", modify(okpKey, func(j *model.JWK) { j.X = b64.EncodeToString(make([]byte, 31)) }), ErrInvalidPublicKey},
+		{"unknown alg", modify(okpKey, func(j *model.JWK) { j.Alg = "none" }), ErrUnsupportedAlg},
+	}
+	for _, c := range invalid {
+		if _, err := KeyFromJWK(c.jwk); !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+// jwksServer отдаёт текущий набор ключей и считает запросы.
+type jwksServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	set    model.JWKSet
+	status int
+	hits   atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...model.JWK) *jwksServer {
+	t.Helper()
+	s := &jwksServer{set: model.JWKSet{Keys: keys}, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.WriteHeader(s.status)
+		_ = json.NewEncoder(w).Encode(s.set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) update(status int, keys ...model.JWK) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.set = model.JWKSet{Keys: keys}
+}
+
+// lookupConcurrently запрашивает kid из n горутин одновременно.
+func lookupConcurrently(source *JWKSSource, kid string, n int) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = source.Key(context.Background(), kid)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestJWKSSourceUnknownKidCooldown(t *testing.T) {
+	first, _ := ecJWK(t, "k1")
+	server := newJWKSServer(t, first)
+	const cooldown = 200 * time.Millisecond
+	source, err := NewJWKSSource(t.Context(), server.URL, WithRefreshInterval(time.Hour), WithMinRefreshInterval(cooldown))
+	if err != nil {
+		t.Fatalf("NewJWKSSource: %v", err)
+	}
+	if _, err := source.Key(context.Background(), "k1"); err != nil {
+		t.Fatalf("Key(k1): %v", err)
+	}
+
+	// выдуманный kid сразу после загрузки: в пределах паузы запросов нет
+	for _, err := range lookupConcurrently(source, "forged", 50) {
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Key(forged): err = %v, want ErrUnknownKey", err)
+		}
+	}
+	if hits := server.hits.Load(); hits != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1 (initial load only)", hits)
+	}
+
+	// после паузы параллельные промахи дают один запрос, и он находит новый ключ
+	second, _ := ecJWK(t, "k2")
+	server.update(http.StatusOK, first, second)
+	time.Sleep(cooldown + 50*time.Millisecond)
+	for _, err := range lookupConcurrently(source, "k2", 50) {
+		if err != nil {
+			t.Fatalf("Key(k2) after rotation: %v", err)
+		}
+	}
+	for _, err := range lookupConcurrently(source, "forged", 50) {
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Key(forged): err = %v, want ErrUnknownKey", err)
+		}
+	}
+	if hits := server.hits.Load(); hits != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", hits)
+	}
+
+	// неудачный запрос тоже выдерживает паузу, а кеш остаётся прежним
+	server.update(http.StatusInternalServerError)
+	time.Sleep(cooldown + 50*time.Millisecond)
+	failures := 0
+	for _, err := range lookupConcurrently(source, "forged", 50) {
+		if errors.Is(err, ErrJWKSFetch) {
+			failures++
+		} else if !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Key(forged) with JWKS down: err = %v", err)
+		}
+	}
+	if hits := server.hits.Load(); hits != 3 || failures != 1 {
+		t.Fatalf("JWKS fetched %d times with %d failures, want 3 and 1", hits, failures)
+	}
+	if _, err := source.Key(context.Background(), "k2"); err != nil {
+		t.Fatalf("Key(k2) after a failed refresh: %v", err)
+	}
+}
+
+func TestJWKSSourceRefreshIgnoresCooldown(t *testing.T) {
+	first, _ := okpJWK(t, "k1")
+	server := newJWKSServer(t, first)
+	source, err := NewJWKSSource(t.Context(), server.URL, WithRefreshInterval(time.Hour), WithMinRefreshInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("NewJWKSSource: %v", err)
+	}
+	second, _ := okpJWK(t, "k2")
+	encryption, _ := rsaJWK(t, "enc")
+	encryption.Use = "enc"
+	server.update(http.StatusOK, second, encryption)
+	if err := source.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := source.Key(context.Background(), "k2"); err != nil {
+		t.Fatalf("Key(k2) after Refresh: %v", err)
+	}
+	for _, kid := range []string{"k1", "enc"} {
+		if _, err := source.Key(context.Background(), kid); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Key(%s) after Refresh: err = %v, want ErrUnknownKey", kid, err)
+		}
+	}
+}
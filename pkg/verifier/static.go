@@ -0,0 +1,89 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StaticKeys — фиксированный набор ключей по kid. Ключ с пустым kid
+// используется для токенов без заголовка kid.
+type StaticKeys map[string]Key
+
+func (s StaticKeys) Key(_ context.Context, kid string) (Key, error) {
+	key, ok := s[kid]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// NewStaticKey принимает любой kid и проверяет одним ключом.
+func NewStaticKey(alg string, public interface{}) (KeySource, error) {
+	if err := checkKeyMatchesAlg(alg, public); err != nil {
+		return nil, err
+	}
+	return singleKey{Key{Alg: alg, Public: public}}, nil
+}
+
+// NewStaticKeyFromPEM разбирает PEM с публичным ключом (PKIX) под алгоритм alg.
+func NewStaticKeyFromPEM(alg string, pemData []byte) (KeySource, error) {
+	var (
+		public interface{}
+		err    error
+	)
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		public, err = jwt.ParseRSAPublicKeyFromPEM(pemData)
+	case "ES256", "ES384", "ES512":
+		public, err = jwt.ParseECPublicKeyFromPEM(pemData)
+	case "EdDSA":
+		public, err = jwt.ParseEdPublicKeyFromPEM(pemData)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	return NewStaticKey(alg, public)
+}
+
+// NewStaticSecret — для сервисов, которые делят HMAC-секрет с сервисом аутентификации.
+func NewStaticSecret(alg string, secret []byte) (KeySource, error) {
+	return NewStaticKey(alg, secret)
+}
+
+type singleKey struct {
+	key Key
+}
+
+func (s singleKey) Key(context.Context, string) (Key, error) {
+	return s.key, nil
+}
+
+func checkKeyMatchesAlg(alg string, public interface{}) error {
+	var ok bool
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		secret, isBytes := public.([]byte)
+		ok = isBytes && len(secret) > 0
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		_, ok = public.(*rsa.PublicKey)
+	case "ES256", "ES384", "ES512":
+		var ec *ecdsa.PublicKey
+		ec, ok = public.(*ecdsa.PublicKey)
+		ok = ok && ec.Curve.Params().BitSize == jwt.GetSigningMethod(alg).(*jwt.SigningMethodECDSA).CurveBits
+	case "EdDSA":
+		_, ok = public.(ed25519.PublicKey)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	if !ok {
+		return fmt.Errorf("%w: key does not match %s", ErrInvalidPublicKey, alg)
+	}
+	return nil
+}
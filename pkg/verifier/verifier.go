@@ -0,0 +1,172 @@
+// Package verifier проверяет токены, выпущенные этим сервисом, без доступа
+// к секретам подписи, Redis и MySQL. Предназначен для импорта в другие Go-сервисы.
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"friend-help/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims — те же claims, что кладёт в токен сервис аутентификации.
+type Claims = model.AuthClaims
+
+var (
+	ErrMissingToken     = errors.New("missing bearer token")
+	ErrInvalidToken     = errors.New("token is invalid")
+	ErrUnknownKey       = errors.New("no verification key for token kid")
+	ErrAlgMismatch      = errors.New("token alg does not match key alg")
+	ErrTokenRevoked     = errors.New("token revoked")
+	ErrJWKSFetch        = errors.New("failed to fetch JWKS")
+	ErrUnsupportedKey   = errors.New("unsupported key type")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// Key — ключ проверки и единственный алгоритм, который им принимается.
+type Key struct {
+	Alg    string
+	Public interface{}
+}
+
+// KeySource отдаёт ключ проверки по kid из заголовка токена (kid может быть пустым).
+type KeySource interface {
+	Key(ctx context.Context, kid string) (Key, error)
+}
+
+// RevocationChecker — необязательная проверка отзыва (например, через общий Redis).
+type RevocationChecker func(ctx context.Context, claims *Claims, token string) (bool, error)
+
+type Option func(*Verifier)
+
+func WithRevocationChecker(check RevocationChecker) Option {
+	return func(v *Verifier) {
+		v.revoked = check
+	}
+}
+
+// WithIssuer требует совпадения claim iss (значение JWT_ISSUER сервиса аутентификации).
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) {
+		v.issuer = strings.TrimRight(issuer, "/")
+	}
+}
+
+// WithAudience требует, чтобы aud токена содержал хотя бы одно из значений.
+func WithAudience(audience ...string) Option {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway задаёт допуск на расхождение часов при проверке exp, nbf и iat.
+func WithLeeway(leeway time.Duration) Option {
+	return func(v *Verifier) {
+		v.leeway = leeway
+	}
+}
+
+type Verifier struct {
+	keys     KeySource
+	revoked  RevocationChecker
+	issuer   string
+	audience []string
+	leeway   time.Duration
+}
+
+const defaultLeeway = 30 * time.Second
+
+func New(keys KeySource, opts ...Option) *Verifier {
+	v := &Verifier{keys: keys, leeway: defaultLeeway}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify проверяет подпись, алгоритм и сроки действия токена и возвращает его claims.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// токены действий (typ action+jwt) не являются access-токенами
+		if typ, _ := token.Header["typ"].(string); typ != "" && typ != model.AccessTokenType {
+			return nil, ErrInvalidToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, ErrAlgMismatch
+		}
+		return key.Public, nil
+	}, v.parserOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject != "" && claims.Subject != strconv.Itoa(claims.UserID) {
+		return nil, ErrInvalidToken
+	}
+	if v.revoked != nil {
+		revoked, err := v.revoked(ctx, claims, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+func (v *Verifier) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.leeway),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if len(v.audience) > 0 {
+		opts = append(opts, jwt.WithAudience(v.audience...))
+	}
+	return opts
+}
+
+type contextKey string
+
+const UserCtxKey contextKey = "user_claims"
+
+func WithUser(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, UserCtxKey, claims)
+}
+
+func GetUserFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(UserCtxKey).(*Claims)
+	return claims, ok
+}
+
+// BearerToken извлекает токен из значения заголовка Authorization.
+func BearerToken(header string) (string, error) {
+	if header == "" {
+		return "", ErrMissingToken
+	}
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(header[7:]), nil
+}
@@ -0,0 +1,118 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"friend-help/internal/model"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID: 42,
+		Role:   model.Member,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   strconv.Itoa(42),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.Claims, header map[string]interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["typ"] = model.AccessTokenType
+	token.Header["kid"] = "k1"
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	keys := StaticKeys{"k1": {Alg: "ES256", Public: &private.PublicKey}}
+	revokedToken := ""
+	v := New(keys, WithIssuer(testIssuer+"/"), WithLeeway(time.Second), WithRevocationChecker(
+		func(ctx context.Context, claims *Claims, token string) (bool, error) {
+			return token == revokedToken, nil
+		}))
+	es256 := func(claims *Claims, header map[string]interface{}) string {
+		return sign(t, jwt.SigningMethodES256, private, claims, header)
+	}
+
+	claims, err := v.Verify(context.Background(), es256(validClaims(), nil))
+	if err != nil || claims.UserID != 42 || claims.Role != model.Member {
+		t.Fatalf("Verify(valid) = %+v, %v", claims, err)
+	}
+
+	with := func(change func(*Claims)) *Claims {
+		c := validClaims()
+		change(c)
+		return c
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	revokedToken = es256(with(func(c *Claims) { c.ID = "revoked" }), nil)
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"empty", "", ErrMissingToken},
+		{"HS256 signed with the public key bytes", sign(t, jwt.SigningMethodHS256, []byte("k1"), validClaims(), nil), ErrAlgMismatch},
+		{"alg none", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims(), nil), ErrInvalidToken},
+		{"signed by another key", sign(t, jwt.SigningMethodES256, other, validClaims(), nil), ErrInvalidToken},
+		{"unknown kid", es256(validClaims(), map[string]interface{}{"kid": "k2"}), ErrUnknownKey},
+		{"action token", es256(validClaims(), map[string]interface{}{"typ": model.ActionTokenType}), ErrInvalidToken},
+		{"wrong issuer", es256(with(func(c *Claims) { c.Issuer = "https://evil.example.com" }), nil), ErrInvalidToken},
+		{"no issuer", es256(with(func(c *Claims) { c.Issuer = "" }), nil), ErrInvalidToken},
+		{"expired", es256(with(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), nil), ErrInvalidToken},
+		{"no exp", es256(with(func(c *Claims) { c.ExpiresAt = nil }), nil), ErrInvalidToken},
+		{"not yet valid", es256(with(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }), nil), ErrInvalidToken},
+		{"issued in the future", es256(with(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Minute)) }), nil), ErrInvalidToken},
+		{"subject does not match user_id", es256(with(func(c *Claims) { c.Subject = "7" }), nil), ErrInvalidToken},
+		{"revoked", revokedToken, ErrTokenRevoked},
+	}
+	for _, c := range cases {
+		if claims, err := v.Verify(context.Background(), c.token); !errors.Is(err, c.want) {
+			t.Errorf("%s: Verify = %+v, %v; want %v", c.name, claims, err, c.want)
+		}
+	}
+}
+
+func TestVerifyAudience(t *testing.T) {
+	secret := []byte("test-secret-key-of-sufficient-length")
+	keys, err := NewStaticSecret("HS256", secret)
+	if err != nil {
+		t.Fatalf("NewStaticSecret: %v", err)
+	}
+	v := New(keys, WithAudience("billing", "reports"))
+	claims := validClaims()
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, secret, claims, nil)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify without aud: err = %v, want ErrInvalidToken", err)
+	}
+	claims.Audience = jwt.ClaimStrings{"reports"}
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, secret, claims, nil)); err != nil {
+		t.Fatalf("Verify with a matching aud: %v", err)
+	}
+}